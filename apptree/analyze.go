@@ -0,0 +1,393 @@
+package apptree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Options configures Analyze.
+type Options struct {
+	// Root is the file or directory to analyze.
+	Root string
+	// FS, if set, is the file system to analyze. Root is then a path
+	// within it as for fs.ReadDir, such as "." for all of it, and so are
+	// the paths of the nodes. Otherwise Analyze walks os.DirFS(Root) and
+	// node paths start with Root.
+	FS fs.FS
+	// PathPrefix, if set along with FS, starts the paths of the nodes
+	// within FS, the path of "." being PathPrefix itself, as when walking
+	// the entries of an archive as archive.zip!/dir/file. The filters see
+	// these paths too.
+	PathPrefix string
+	// Exclude holds glob patterns, as for filepath.Match, matched against
+	// base names. Matching files and directories are left out.
+	Exclude []string
+	// MaxDepth limits how many levels below Root are walked; 0 walks the
+	// whole tree.
+	MaxDepth int
+	// Skip, if set, reports whether to leave out the entry at path before
+	// any other filter applies; Pin doesn't override it.
+	Skip func(path string) bool
+	// SkipEmpty leaves out empty files.
+	SkipEmpty bool
+	// Name, if set, includes only the files whose base name it matches,
+	// and ExcludeName leaves out those whose base name it matches, taking
+	// precedence over Name.
+	Name        *regexp.Regexp
+	ExcludeName *regexp.Regexp
+	// IncludeTypes, if not empty, includes only the files whose MIME type
+	// is in one of its categories, such as "text" or "image", and
+	// ExcludeTypes leaves out those in one of its categories.
+	IncludeTypes []string
+	ExcludeTypes []string
+	// TypeOf, if set, returns the MIME type of the file at path for
+	// IncludeTypes and ExcludeTypes. By default the type is guessed from
+	// the extension and the start of the file.
+	TypeOf func(path string) string
+	// Select, if set, reports whether the entry at path that passed
+	// Exclude is included, along with the reason given to Explain. It
+	// applies before SkipEmpty and the name and type filters.
+	Select func(path string, info fs.FileInfo) (include bool, reason string)
+	// Filter, if set, reports whether the entry at path is included, after
+	// all other filters. Directories it rejects are left out with their
+	// contents. It is not called for Root.
+	Filter func(path string, info fs.FileInfo) bool
+	// Explain, if set, is called with every decision on an entry below
+	// the root and its reason, one of the Reason constants or a reason
+	// given by Select.
+	Explain func(path string, info fs.FileInfo, include bool, reason string)
+	// Descend, if set, reports whether to walk into an included directory.
+	// Directories it rejects are kept without children.
+	Descend func(path string) bool
+	// SortBy orders the entries of each directory by SortName, the default,
+	// SortSize or SortModTime. Entries that compare equal keep their lexical
+	// order.
+	SortBy string
+	// DirsFirst lists the directories of each directory before its files,
+	// and FilesFirst after them.
+	DirsFirst  bool
+	FilesFirst bool
+	// LimitPerDir keeps at most that many entries of each directory, in
+	// order; 0 keeps them all. Entries matching Pin are kept regardless.
+	LimitPerDir int
+	// Pin holds glob patterns, as for filepath.Match, matched against base
+	// names and whole paths. Matching files are included whatever the
+	// filters other than Skip say.
+	Pin []string
+	// Concurrency is how many directories are listed at once; 0 and 1 walk
+	// the tree sequentially. The filters, Explain and Descend must be safe
+	// for concurrent use when it is above 1. Stream always walks
+	// sequentially, and a ContentWriter then reads up to that many files
+	// of each directory ahead of the output.
+	Concurrency int
+	// Format names the registered renderer Render uses for the result, or
+	// the stream renderer Write uses, text by default. Analyze itself
+	// doesn't use it.
+	Format string
+
+	// The options below configure the output of a ContentWriter.
+
+	// Framing configures the stream renderers of this package.
+	Framing Framing
+	// Load, if set, reads the content of a file in place of reading it from
+	// the analyzed file system. release, if not nil, is called once the
+	// content is no longer needed. Load must be safe for concurrent use
+	// when Concurrency is above 1.
+	Load func(file Entry) (content []byte, release func(), err error)
+	// ContentType, if set, returns the MIME type of the file at path with
+	// content. By default the type is detected by http.DetectContentType.
+	ContentType func(path string, content []byte) string
+	// Prepare, if set, is called with every file read before it is
+	// written. It may change the file, such as transforming its Content,
+	// and returning false leaves the file out.
+	Prepare func(f *File) bool
+	// Describe, if set, returns the Meta of an entry to write.
+	Describe func(e Entry) Meta
+	// OnError, if set, is told of the errors reading files.
+	OnError func(path string, err error)
+}
+
+// The orders of Options.SortBy.
+const (
+	SortName    = "name"
+	SortSize    = "size"
+	SortModTime = "mtime"
+)
+
+// Analyze walks opts.Root and returns the tree of the entries selected by
+// opts, with the entries of each directory in lexical order unless opts
+// order them otherwise. Errors reading entries below the root are recorded
+// in their nodes rather than returned.
+func Analyze(opts Options) (*Node, error) {
+	return AnalyzeContext(context.Background(), opts)
+}
+
+// AnalyzeContext is Analyze, stopping early when ctx is done. It then
+// returns the tree walked so far, with Partial set on the root and on every
+// directory whose entries were cut short, along with ctx.Err().
+func AnalyzeContext(ctx context.Context, opts Options) (*Node, error) {
+	a, rootEntry, err := newAnalysis(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	root := a.newNode(rootEntry)
+	if root.Dir {
+		if opts.Concurrency > 1 {
+			// The walking goroutine holds one slot itself.
+			a.slots = make(chan struct{}, opts.Concurrency-1)
+		}
+		a.walk(root, rootEntry)
+	}
+	root.Walk(func(n *Node) {
+		root.Partial = root.Partial || n.Partial
+	})
+	if root.Partial {
+		return root, ctx.Err()
+	}
+	return root, nil
+}
+
+// analysis holds the state of one call to Analyze or Stream.
+type analysis struct {
+	ctx  context.Context
+	opts Options
+	fsys fs.FS
+	// slots limits the goroutines listing directories besides the caller's,
+	// or is nil to walk sequentially.
+	slots chan struct{}
+	// stopped records that Stream cut the walk short.
+	stopped bool
+}
+
+// newAnalysis checks opts and returns the analysis they describe along
+// with the entry of the root.
+func newAnalysis(ctx context.Context, opts Options) (*analysis, Entry, error) {
+	if opts.Root == "" {
+		return nil, Entry{}, errors.New("apptree: no root to analyze")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, Entry{}, err
+	}
+	a := &analysis{ctx: ctx, opts: opts, fsys: opts.FS}
+	rootPath := opts.Root
+	var info fs.FileInfo
+	var err error
+	if a.fsys == nil {
+		info, err = os.Lstat(opts.Root)
+		a.fsys, rootPath = os.DirFS(opts.Root), "."
+	} else if !fs.ValidPath(rootPath) {
+		err = &fs.PathError{Op: "analyze", Path: rootPath, Err: fs.ErrInvalid}
+	} else {
+		info, err = lstat(a.fsys, rootPath)
+	}
+	if err != nil {
+		return nil, Entry{}, err
+	}
+	for _, pattern := range append(append([]string(nil), opts.Exclude...), opts.Pin...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, Entry{}, err
+		}
+	}
+	switch opts.SortBy {
+	case "", SortName, SortSize, SortModTime:
+	default:
+		return nil, Entry{}, fmt.Errorf("apptree: unknown sort order %q", opts.SortBy)
+	}
+	return a, a.newEntry(rootPath, info, 0), nil
+}
+
+// walk adds the entries of the directory node, whose entry is dir, to its
+// children.
+func (a *analysis) walk(node *Node, dir Entry) {
+	if !a.opts.descends(dir) {
+		return
+	}
+	if a.ctx.Err() != nil {
+		node.Partial = true
+		return
+	}
+	entries, _, err := a.list(dir)
+	if err != nil {
+		node.Err = err
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		if a.ctx.Err() != nil {
+			node.Partial = true
+			break
+		}
+		child := a.newNode(entry)
+		node.Children = append(node.Children, child)
+		if !child.Dir {
+			continue
+		}
+		entry := entry
+		select {
+		case a.slots <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a.walk(child, entry)
+				<-a.slots
+			}()
+		default:
+			// Walk inline when no slot is free, so nested directories
+			// never wait on their parents.
+			a.walk(child, entry)
+		}
+	}
+	wg.Wait()
+
+	for _, child := range node.Children {
+		node.Size += child.Size
+	}
+}
+
+// list returns the entries of the directory dir the analysis includes, in
+// order, and the number LimitPerDir left out.
+func (a *analysis) list(dir Entry) (entries []Entry, omitted int, err error) {
+	dirEntries, err := fs.ReadDir(a.fsys, dir.fsPath)
+	if err != nil {
+		var pathErr *fs.PathError
+		if a.opts.FS == nil && errors.As(err, &pathErr) {
+			// Report the path the caller knows rather than one within
+			// os.DirFS.
+			pathErr.Path = dir.Path
+		}
+		return nil, 0, err
+	}
+
+	all := make([]Entry, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		fsPath := path.Join(dir.fsPath, d.Name())
+		info, err := d.Info()
+		if err != nil {
+			all = append(all, Entry{Name: d.Name(), Path: a.nodePath(fsPath), Depth: dir.Depth + 1, Err: err, fsys: a.fsys, fsPath: fsPath})
+			continue
+		}
+		all = append(all, a.newEntry(fsPath, info, dir.Depth+1))
+	}
+	a.opts.order(all)
+
+	for _, e := range all {
+		if e.Info != nil && !a.opts.Include(e.Path, e.Info) {
+			continue
+		}
+		if a.opts.LimitPerDir > 0 && len(entries) >= a.opts.LimitPerDir && !a.opts.Pinned(e.Path) {
+			omitted++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, omitted, nil
+}
+
+// descends reports whether the entries of the directory dir are walked:
+// it is within MaxDepth and, below the root, accepted by Descend.
+func (o Options) descends(dir Entry) bool {
+	if o.MaxDepth > 0 && dir.Depth >= o.MaxDepth {
+		return false
+	}
+	return dir.Depth == 0 || o.Descend == nil || o.Descend(dir.Path)
+}
+
+// order sorts entries, listed in lexical order, by SortBy, DirsFirst and
+// FilesFirst.
+func (o Options) order(entries []Entry) {
+	byName := o.SortBy == "" || o.SortBy == SortName
+	if byName && !o.DirsFirst && !o.FilesFirst {
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir() != b.IsDir() && (o.DirsFirst || o.FilesFirst) {
+			return a.IsDir() != o.FilesFirst
+		}
+		if byName || a.Info == nil || b.Info == nil {
+			return false
+		}
+		if o.SortBy == SortSize {
+			return a.Info.Size() > b.Info.Size()
+		}
+		return a.Info.ModTime().After(b.Info.ModTime())
+	})
+}
+
+// Excluded reports whether an entry with the base name name matches one of
+// the Exclude patterns.
+func (o Options) Excluded(name string) bool {
+	for _, pattern := range o.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Pinned reports whether path matches one of the Pin patterns, either by
+// its base name or as a whole.
+func (o Options) Pinned(path string) bool {
+	for _, pattern := range o.Pin {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newEntry returns the entry at fsPath within the analyzed file system,
+// depth levels below the root.
+func (a *analysis) newEntry(fsPath string, info fs.FileInfo, depth int) Entry {
+	return Entry{Name: info.Name(), Path: a.nodePath(fsPath), Info: info, Depth: depth, fsys: a.fsys, fsPath: fsPath}
+}
+
+// newNode returns the node for e.
+func (a *analysis) newNode(e Entry) *Node {
+	n := &Node{Name: e.Name, Path: e.Path, Err: e.Err, fsys: e.fsys, fsPath: e.fsPath}
+	if e.Info == nil {
+		return n
+	}
+	n.Dir, n.ModTime, n.Info = e.Info.IsDir(), e.Info.ModTime(), e.Info
+	if !n.Dir {
+		n.Size = e.Info.Size()
+	}
+	return n
+}
+
+// nodePath returns the path reported for the entry at fsPath.
+func (a *analysis) nodePath(fsPath string) string {
+	switch {
+	case a.opts.FS != nil && a.opts.PathPrefix != "" && fsPath == ".":
+		return a.opts.PathPrefix
+	case a.opts.FS != nil:
+		return a.opts.PathPrefix + fsPath
+	case fsPath == ".":
+		return a.opts.Root
+	default:
+		return filepath.Join(a.opts.Root, filepath.FromSlash(fsPath))
+	}
+}
+
+// lstat returns the info of name in fsys without following a final
+// symbolic link when fsys supports that, as os.DirFS does.
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if l, ok := fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	}); ok {
+		return l.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
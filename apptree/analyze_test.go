@@ -0,0 +1,518 @@
+package apptree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// writeTree creates files, given as slash-separated paths relative to dir
+// mapped to their content, below dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// relPaths returns the paths of the nodes below root relative to it, in
+// walk order.
+func relPaths(root *Node) []string {
+	var paths []string
+	root.Walk(func(n *Node) {
+		if n == root {
+			return
+		}
+		rel, _ := filepath.Rel(root.Path, n.Path)
+		rel = filepath.ToSlash(rel)
+		if n.Dir {
+			rel += "/"
+		}
+		paths = append(paths, rel)
+	})
+	return paths
+}
+
+func TestAnalyze(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.go":            "package main\n",
+		"README.md":          "# demo\n",
+		"internal/a/a.go":    "package a\n",
+		"internal/a/b/b.go":  "package b\n",
+		"vendor/x/x.go":      "package x\n",
+		"testdata/large.txt": strings.Repeat("x", 100),
+	})
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "everything",
+			want: []string{"README.md", "internal/", "internal/a/", "internal/a/a.go", "internal/a/b/", "internal/a/b/b.go", "main.go", "testdata/", "testdata/large.txt", "vendor/", "vendor/x/", "vendor/x/x.go"},
+		},
+		{
+			name: "exclude",
+			opts: Options{Exclude: []string{"vendor", "*.md"}},
+			want: []string{"internal/", "internal/a/", "internal/a/a.go", "internal/a/b/", "internal/a/b/b.go", "main.go", "testdata/", "testdata/large.txt"},
+		},
+		{
+			name: "max depth",
+			opts: Options{MaxDepth: 2},
+			want: []string{"README.md", "internal/", "internal/a/", "main.go", "testdata/", "testdata/large.txt", "vendor/", "vendor/x/"},
+		},
+		{
+			name: "filter",
+			opts: Options{Filter: func(path string, info fs.FileInfo) bool {
+				return info.IsDir() || info.Size() < 50
+			}},
+			want: []string{"README.md", "internal/", "internal/a/", "internal/a/a.go", "internal/a/b/", "internal/a/b/b.go", "main.go", "testdata/", "vendor/", "vendor/x/", "vendor/x/x.go"},
+		},
+		{
+			name: "descend",
+			opts: Options{Descend: func(path string) bool { return filepath.Base(path) != "internal" }},
+			want: []string{"README.md", "internal/", "main.go", "testdata/", "testdata/large.txt", "vendor/", "vendor/x/", "vendor/x/x.go"},
+		},
+		{
+			name: "dirs first",
+			opts: Options{MaxDepth: 1, DirsFirst: true},
+			want: []string{"internal/", "testdata/", "vendor/", "README.md", "main.go"},
+		},
+		{
+			name: "files first by size",
+			opts: Options{MaxDepth: 1, FilesFirst: true, SortBy: SortSize},
+			want: []string{"main.go", "README.md", "internal/", "testdata/", "vendor/"},
+		},
+		{
+			name: "limit per dir",
+			opts: Options{MaxDepth: 1, LimitPerDir: 2, Pin: []string{"main.go"}},
+			want: []string{"README.md", "internal/", "main.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Root = dir
+			root, err := Analyze(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := relPaths(root); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got paths\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestAnalyzeSizes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a": "12345", "sub/b": "123", "sub/c": ""})
+
+	root, err := Analyze(Options{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Size != 8 {
+		t.Errorf("root size = %d, want 8", root.Size)
+	}
+	if files := root.Files(); len(files) != 3 {
+		t.Errorf("got %d files, want 3", len(files))
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	if _, err := Analyze(Options{}); err == nil {
+		t.Error("Analyze without a root succeeded")
+	}
+	if _, err := Analyze(Options{Root: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("Analyze of a missing root succeeded")
+	}
+	if _, err := Analyze(Options{Root: t.TempDir(), Exclude: []string{"["}}); err == nil {
+		t.Error("Analyze with a malformed pattern succeeded")
+	}
+	if _, err := Analyze(Options{Root: t.TempDir(), SortBy: "color"}); err == nil {
+		t.Error("Analyze with an unknown sort order succeeded")
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "a", "sub/b.txt": "bb"})
+	root, err := Analyze(Options{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text bytes.Buffer
+	if err := RenderText(&text, root); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Base(dir) + "/\n  a.txt\n  sub/\n    b.txt\n"
+	if text.String() != want {
+		t.Errorf("RenderText wrote\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	if err := RenderJSON(&out, root); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Node
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Size != 3 || len(decoded.Children) != 2 || decoded.Children[1].Children[0].Name != "b.txt" {
+		t.Errorf("RenderJSON wrote %s", out.String())
+	}
+}
+
+func TestAnalyzeConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			files[fmt.Sprintf("d%02d/e%d/f.txt", i, j)] = strings.Repeat("x", i+j)
+		}
+	}
+	writeTree(t, dir, files)
+
+	want, err := Analyze(NewOptions(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{2, 8, 64} {
+		got, err := Analyze(NewOptions(dir, WithConcurrency(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := strings.Join(relPaths(got), "\n"), strings.Join(relPaths(want), "\n"); g != w {
+			t.Errorf("concurrency %d: got paths\n%s\nwant\n%s", n, g, w)
+		}
+		if got.Size != want.Size {
+			t.Errorf("concurrency %d: size = %d, want %d", n, got.Size, want.Size)
+		}
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	opts := NewOptions("root",
+		WithExcludes("a"),
+		WithExcludes("b", "c"),
+		WithMaxDepth(3),
+		WithMaxDepth(2),
+		WithConcurrency(4),
+		WithFormat(FormatJSON),
+	)
+	if opts.Root != "root" || strings.Join(opts.Exclude, ",") != "a,b,c" || opts.MaxDepth != 2 || opts.Concurrency != 4 || opts.Format != FormatJSON {
+		t.Errorf("NewOptions = %+v", opts)
+	}
+	if !opts.Excluded("b") || opts.Excluded("d") {
+		t.Errorf("Excluded doesn't match the patterns %q", opts.Exclude)
+	}
+}
+
+func TestRenderFormats(t *testing.T) {
+	root := &Node{Name: "r", Dir: true}
+	for _, format := range []string{"", FormatText, FormatJSON} {
+		if err := Render(io.Discard, root, format); err != nil {
+			t.Errorf("Render(%q): %v", format, err)
+		}
+	}
+	if err := Render(io.Discard, root, "yaml"); err == nil {
+		t.Error("Render of an unknown format succeeded")
+	}
+}
+
+func TestAnalyzeContext(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/1": "", "a/2": "", "b/3": "", "c/4": ""})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := AnalyzeContext(ctx, Options{Root: dir}); !errors.Is(err, context.Canceled) {
+		t.Errorf("AnalyzeContext with a cancelled context returned %v", err)
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		root, err := AnalyzeContext(ctx, Options{Root: dir, Concurrency: concurrency, Filter: func(path string, info fs.FileInfo) bool {
+			if filepath.Base(path) == "b" {
+				cancel()
+			}
+			return true
+		}})
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("concurrency %d: err = %v, want context.Canceled", concurrency, err)
+		}
+		if root == nil || !root.Partial {
+			t.Fatalf("concurrency %d: got %+v, want a partial tree", concurrency, root)
+		}
+		for _, path := range relPaths(root) {
+			if strings.HasPrefix(path, "c") {
+				t.Errorf("concurrency %d: walked %s after cancellation", concurrency, path)
+			}
+		}
+	}
+
+	root, err := AnalyzeContext(context.Background(), Options{Root: dir})
+	if err != nil || root.Partial {
+		t.Errorf("complete analysis returned partial=%v, err=%v", root.Partial, err)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a<b>.txt": "a", "sub/c.md": "cc"})
+	root, err := Analyze(Options{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.Name = "demo"
+
+	stats := Summarize(root)
+	if want := (Stats{Files: 2, Dirs: 1, Size: 3}); stats != want {
+		t.Errorf("Summarize = %+v, want %+v", stats, want)
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatText, []string{"demo/\n  a<b>.txt\n  sub/\n    c.md\n", "1 directories, 2 files, 3 bytes"}},
+		{FormatJSON, []string{`"stats": {`, `"files": 2`, `"name": "c.md"`}},
+		{FormatHTML, []string{"<h1>demo</h1>", "<li>a&lt;b&gt;.txt</li>", "<li>sub/", "<li>c.md</li>"}},
+		{FormatMarkdown, []string{"# demo\n", "- `a<b>.txt`\n- `sub/`\n  - `c.md`\n", "1 directories, 2 files"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Render(&out, root, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output lacks %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+
+	if got := strings.Join(Formats(), ","); !strings.Contains(got, "html,json,markdown") {
+		t.Errorf("Formats() = %s", got)
+	}
+}
+
+// TestRenderConcurrent checks that the json and html renderers write the
+// same output whether or not they split the tree among goroutines, and that
+// json is indented as by an Encoder.
+func TestRenderConcurrent(t *testing.T) {
+	mod := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var build func(name string, depth int) *Node
+	build = func(name string, depth int) *Node {
+		n := &Node{Name: name, Path: "root/" + name, Dir: true, ModTime: mod}
+		for i := 0; i < 60; i++ {
+			n.Children = append(n.Children, &Node{Name: fmt.Sprintf("f%d<&>.txt", i), Path: name, Size: int64(i), ModTime: mod})
+		}
+		if depth < 3 {
+			for i := 0; i < 6; i++ {
+				n.Children = append(n.Children, build(fmt.Sprintf("%s/d%d", name, i), depth+1))
+			}
+		}
+		n.Children = append(n.Children, &Node{Name: "empty", Dir: true, Partial: depth == 2})
+		return n
+	}
+	tree := build("root", 0)
+	tree.Partial = true
+	stats := Summarize(tree)
+
+	var want bytes.Buffer
+	enc := json.NewEncoder(&want)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(struct {
+		Stats Stats `json:"stats"`
+		Tree  *Node `json:"tree"`
+	}{stats, tree}); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{FormatJSON, FormatHTML} {
+		r, _ := Lookup(format)
+		cr, ok := r.(ConcurrentRenderer)
+		if !ok {
+			t.Fatalf("the %s renderer isn't a ConcurrentRenderer", format)
+		}
+		var seq bytes.Buffer
+		if err := r.Render(&seq, tree, stats); err != nil {
+			t.Fatal(err)
+		}
+		if format == FormatJSON && seq.String() != want.String() {
+			t.Errorf("json differs from the Encoder output\n%s", seq.String())
+		}
+		for _, n := range []int{1, 2, 4, 16} {
+			var got bytes.Buffer
+			if err := cr.RenderConcurrent(&got, tree, stats, n); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != seq.String() {
+				t.Errorf("%s with %d goroutines differs from Render", format, n)
+			}
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a format twice didn't panic")
+		}
+	}()
+	Register(FormatText, RendererFunc(renderText))
+}
+
+func TestAnalyzeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":             {Data: []byte("module demo\n")},
+		"cmd/demo/main.go":   {Data: []byte("package main\n")},
+		"cmd/demo/main.pb":   {Data: []byte("generated")},
+		"docs/guide.md":      {Data: []byte("# Guide\n")},
+		"docs/img/logo.png":  {Data: []byte("\x89PNG")},
+		"internal/empty/.gk": {},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "root",
+			opts: Options{Root: "."},
+			want: []string{"cmd", "cmd/demo", "cmd/demo/main.go", "cmd/demo/main.pb", "docs", "docs/guide.md", "docs/img", "docs/img/logo.png", "go.mod", "internal", "internal/empty", "internal/empty/.gk"},
+		},
+		{
+			name: "subdirectory",
+			opts: Options{Root: "docs"},
+			want: []string{"docs/guide.md", "docs/img", "docs/img/logo.png"},
+		},
+		{
+			name: "options",
+			opts: NewOptions(".", WithExcludes("*.pb", "internal"), WithMaxDepth(2), WithConcurrency(3)),
+			want: []string{"cmd", "cmd/demo", "docs", "docs/guide.md", "docs/img", "go.mod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.FS = fsys
+			root, err := Analyze(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			root.Walk(func(n *Node) {
+				if n != root {
+					got = append(got, n.Path)
+				}
+			})
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got paths\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	root, err := Analyze(Options{FS: fsys, Root: "cmd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name != "cmd" || root.Size != int64(len("package main\n")+len("generated")) {
+		t.Errorf("got root %q of size %d", root.Name, root.Size)
+	}
+
+	for _, bad := range []string{"", "/abs", "../up", "missing"} {
+		if _, err := Analyze(Options{FS: fsys, Root: bad}); err == nil {
+			t.Errorf("Analyze of root %q succeeded", bad)
+		}
+	}
+}
+
+func TestAnalyzeSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"real/f.txt": "f"})
+	if err := os.Symlink("real", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	root, err := Analyze(Options{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(relPaths(root), ","), "link,real/,real/f.txt"; got != want {
+		t.Errorf("got paths %s, want %s", got, want)
+	}
+
+	root, err = Analyze(Options{Root: filepath.Join(dir, "link")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Dir || root.Info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("a symlinked root was followed: %+v", root)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.md":                     {Data: []byte("# mono\n")},
+		"services/api/main.go":          {Data: []byte("package main\n")},
+		"services/api/handlers/user.go": {Data: []byte("package handlers\n")},
+		"services/web/index.js":         {Data: []byte("run()\n")},
+		"services/NOTES.md":             {Data: []byte("notes\n")},
+		"libs/log/log.go":               {Data: []byte("package log\n")},
+		"tools/empty":                   {Mode: fs.ModeDir},
+	}
+	root, err := Analyze(Options{FS: fsys, Root: "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{1, "./\n  README.md\n  libs/\n    log/\n      log.go\n  services/\n    NOTES.md\n    api/\n      handlers/\n        user.go\n      main.go\n    web/\n      index.js\n  tools/\n    empty/\n"},
+		{2, "./\n  README.md\n  libs/log/\n    log.go\n  services/NOTES.md\n  services/api/\n    handlers/\n      user.go\n    main.go\n  services/web/\n    index.js\n  tools/empty/\n"},
+		{3, "./\n  README.md\n  libs/log/log.go\n  services/NOTES.md\n  services/api/handlers/\n    user.go\n  services/api/main.go\n  services/web/index.js\n  tools/empty/\n"},
+	}
+	for _, tt := range tests {
+		flat := Flatten(root, tt.depth)
+		var out bytes.Buffer
+		if err := RenderText(&out, flat); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("Flatten(%d) rendered\n%s\nwant\n%s", tt.depth, out.String(), tt.want)
+		}
+		if flat.Size != root.Size {
+			t.Errorf("Flatten(%d) changed the size from %d to %d", tt.depth, root.Size, flat.Size)
+		}
+	}
+
+	// The original tree is left as it was.
+	if root.Children[1].Name != "libs" || len(root.Children) != 4 {
+		t.Errorf("Flatten modified the tree: %+v", root.Children)
+	}
+}
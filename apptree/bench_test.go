@@ -0,0 +1,196 @@
+package apptree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchmarkSizes are the numbers of files in the synthetic benchmark trees.
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+var (
+	syntheticMu    sync.Mutex
+	syntheticTrees = map[int]string{}
+	syntheticBase  string
+)
+
+// writeSyntheticTree creates a tree of n files below dir. It is the same
+// for a given n: directories fan out ten ways, each holds up to twenty
+// files, and file sizes cycle from 0 to about 4 KB.
+func writeSyntheticTree(dir string, n int) error {
+	const filesPerDir, fanOut = 20, 10
+	for i := 0; i < n; i++ {
+		d := i / filesPerDir
+		var parts []string
+		for d > 0 {
+			parts = append([]string{fmt.Sprintf("d%d", d%fanOut)}, parts...)
+			d /= fanOut
+		}
+		sub := filepath.Join(append([]string{dir}, parts...)...)
+		if i%filesPerDir == 0 {
+			if err := os.MkdirAll(sub, 0755); err != nil {
+				return err
+			}
+		}
+		ext := []string{".go", ".md", ".json", ".txt"}[i%4]
+		content := strings.Repeat("x", (i*37)%4096)
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%05d%s", i, ext)), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syntheticTree returns the root of a synthetic tree of n files, creating
+// it once per test binary run.
+func syntheticTree(b *testing.B, n int) string {
+	b.Helper()
+	if testing.Short() && n > 10000 {
+		b.Skip("skipping the largest tree in short mode")
+	}
+	syntheticMu.Lock()
+	defer syntheticMu.Unlock()
+	if root, ok := syntheticTrees[n]; ok {
+		return root
+	}
+	if syntheticBase == "" {
+		dir, err := os.MkdirTemp("", "apptree-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		syntheticBase = dir
+	}
+	root := filepath.Join(syntheticBase, fmt.Sprintf("tree%d", n))
+	if err := writeSyntheticTree(root, n); err != nil {
+		b.Fatal(err)
+	}
+	syntheticTrees[n] = root
+	return root
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if syntheticBase != "" {
+		os.RemoveAll(syntheticBase)
+	}
+	os.Exit(code)
+}
+
+func BenchmarkAnalyze(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, concurrency := range []int{1, 8} {
+			b.Run(fmt.Sprintf("files=%d/concurrency=%d", n, concurrency), func(b *testing.B) {
+				root := syntheticTree(b, n)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := Analyze(NewOptions(root, WithConcurrency(concurrency))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, format := range []string{FormatText, FormatJSON} {
+			b.Run(fmt.Sprintf("files=%d/format=%s", n, format), func(b *testing.B) {
+				tree, err := Analyze(NewOptions(syntheticTree(b, n)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := Render(io.Discard, tree, format); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkWrite measures the content path: a ContentWriter streaming
+// every file of the tree in the text and jsonl formats, reading the files
+// in order and with eight read ahead.
+func BenchmarkWrite(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, format := range []string{FormatText, FormatJSONL} {
+			for _, concurrency := range []int{1, 8} {
+				b.Run(fmt.Sprintf("files=%d/format=%s/concurrency=%d", n, format, concurrency), func(b *testing.B) {
+					opts := Options{Root: syntheticTree(b, n), Format: format, Concurrency: concurrency}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if err := Write(context.Background(), io.Discard, opts); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkRenderConcurrent measures the json and html renderers splitting
+// the tree among goroutines, against concurrency=1 rendering it in one.
+func BenchmarkRenderConcurrent(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, format := range []string{FormatJSON, FormatHTML} {
+			for _, concurrency := range []int{1, 8} {
+				b.Run(fmt.Sprintf("files=%d/format=%s/concurrency=%d", n, format, concurrency), func(b *testing.B) {
+					tree, err := Analyze(NewOptions(syntheticTree(b, n)))
+					if err != nil {
+						b.Fatal(err)
+					}
+					stats := Summarize(tree)
+					r, _ := Lookup(format)
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if err := r.(ConcurrentRenderer).RenderConcurrent(io.Discard, tree, stats, concurrency); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSyntheticTree(t *testing.T) {
+	for _, n := range []int{1, 45, 250} {
+		dir := t.TempDir()
+		if err := writeSyntheticTree(dir, n); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := Analyze(Options{Root: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(tree.Files()); got != n {
+			t.Errorf("tree of %d files has %d", n, got)
+		}
+
+		again := t.TempDir()
+		if err := writeSyntheticTree(again, n); err != nil {
+			t.Fatal(err)
+		}
+		other, err := Analyze(Options{Root: again})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := strings.Join(relPaths(tree), ","), strings.Join(relPaths(other), ","); a != b || tree.Size != other.Size {
+			t.Errorf("trees of %d files differ between runs", n)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package apptree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// ErrChanged reports a file deleted, truncated or grown between listing
+// its directory and reading it.
+var ErrChanged = errors.New("file changed during scan")
+
+// File is a file written by a ContentWriter, with its content.
+type File struct {
+	Entry
+	// Type is the MIME type of the content.
+	Type string
+	// Size is the size of the content as read.
+	Size int64
+	// Raw is the content as read, and Content the content to write, which
+	// Options.Prepare may have transformed.
+	Raw     []byte
+	Content []byte
+	// HeaderOnly leaves the content out of the block of the file.
+	HeaderOnly bool
+	// InvalidUTF8 marks text content whose invalid UTF-8 was replaced.
+	InvalidUTF8 bool
+}
+
+// IsText reports whether the content of f is text.
+func (f File) IsText() bool {
+	return IsText(f.Type)
+}
+
+// IsText reports whether mimeType denotes text content.
+func IsText(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text")
+}
+
+// Meta is what the renderers show about an entry besides its file info,
+// as told by Options.Describe.
+type Meta struct {
+	// Size is the total size of the files below a directory, when known.
+	Size *int64
+	// Submodule marks a git submodule, and Ignored an entry kept in spite
+	// of a .gitignore file.
+	Submodule bool
+	Ignored   bool
+	// Author and Date describe the last commit changing a file.
+	Author string
+	Date   string
+	// Xattrs lists the extended attributes of a file.
+	Xattrs []Xattr
+}
+
+// Xattr is an extended attribute of a file.
+type Xattr struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// Note is a remark written among the blocks of the entries.
+type Note struct {
+	// Kind is one of the Note constants.
+	Kind string
+	// Path is the entry the note is about, and Depth its depth.
+	Path  string
+	Depth int
+	// Omitted is the number of entries left out.
+	Omitted int
+	// Text is the remark written by the text framings, and Markup, if
+	// set, the one written in its place by the html format, at the end of
+	// the page. Records are written in their place by the record formats.
+	Text    string
+	Markup  string
+	Records []Record
+}
+
+// The kinds of Note.
+const (
+	// NoteMore follows the entries of a directory LimitPerDir cut short.
+	NoteMore = "more"
+	// NoteChanged takes the place of the block of a file that changed
+	// between listing and reading it.
+	NoteChanged = "changed"
+	// NoteText is a remark given as Text, Markup and Records.
+	NoteText = "text"
+)
+
+// A ContentWriter is a Visitor writing the entries Stream visits, with the
+// content of their files, to w through a StreamRenderer. With Concurrency
+// above 1, the files among the entries given to Dir are read ahead of the
+// output, up to Concurrency at once; File must then be called with them in
+// order, as Stream does, though it may skip some.
+type ContentWriter struct {
+	ctx  context.Context
+	w    io.Writer
+	r    StreamRenderer
+	opts Options
+	// prefetches holds the prefetcher of every directory being visited,
+	// innermost last.
+	prefetches []*prefetcher
+	err        error
+}
+
+// NewContentWriter returns a ContentWriter writing to w through r with
+// opts. It stops reading ahead once ctx is done.
+func NewContentWriter(ctx context.Context, w io.Writer, r StreamRenderer, opts Options) *ContentWriter {
+	return &ContentWriter{ctx: ctx, w: w, r: r, opts: opts}
+}
+
+// Write walks opts.Root like Stream, writing the entries with the content
+// of their files to w in the format opts.Format names, text by default.
+func Write(ctx context.Context, w io.Writer, opts Options) error {
+	format := opts.Format
+	if format == "" {
+		format = FormatText
+	}
+	r, err := NewStreamRenderer(format, opts.Framing)
+	if err != nil {
+		return err
+	}
+	if err := r.Begin(w); err != nil {
+		return err
+	}
+	c := NewContentWriter(ctx, w, r, opts)
+	if err := Stream(ctx, opts, c); err != nil {
+		return err
+	}
+	if c.err != nil {
+		return c.err
+	}
+	return r.End(w)
+}
+
+// Err returns the first error writing the output.
+func (c *ContentWriter) Err() error {
+	return c.err
+}
+
+// Dir writes the header of dir, unless Framing.OmitDirs leaves it out,
+// and starts reading the files among entries. A directory that couldn't
+// be listed is written with its error when that was for lack of
+// permission; other errors are left to the caller to report.
+func (c *ContentWriter) Dir(dir Entry, entries []Entry) {
+	var p *prefetcher
+	defer func() { c.prefetches = append(c.prefetches, p) }()
+
+	if dir.Err != nil {
+		if errors.Is(dir.Err, fs.ErrPermission) {
+			c.render(c.r.Dir(c.w, c.describe(dir)))
+		}
+		return
+	}
+	if !c.opts.Framing.OmitDirs {
+		c.render(c.r.Dir(c.w, c.describe(dir)))
+	}
+	p = c.prefetch(entries)
+}
+
+// File reads file and writes its block, or the NoteChanged note when the
+// file changed since it was listed. Errors reading it are told to
+// Options.OnError.
+func (c *ContentWriter) File(file Entry) {
+	if file.Info == nil {
+		return
+	}
+	var l *loadedFile
+	if n := len(c.prefetches); n > 0 {
+		l = c.prefetches[n-1].next(file)
+	}
+	if l == nil {
+		loaded := c.load(file)
+		l = &loaded
+	}
+	if l.release != nil {
+		defer l.release()
+	}
+	if l.err != nil {
+		if c.opts.OnError != nil {
+			c.opts.OnError(file.Path, l.err)
+		}
+		if errors.Is(l.err, ErrChanged) {
+			c.Note(Note{Kind: NoteChanged, Path: file.Path, Depth: file.Depth})
+		}
+		return
+	}
+
+	f := File{Entry: file, Size: int64(len(l.content)), Raw: l.content, Content: l.content}
+	f.Type = c.opts.contentType(file.Path, l.content)
+	if c.opts.Prepare != nil && !c.opts.Prepare(&f) {
+		return
+	}
+	c.WriteFile(f)
+}
+
+// EndDir writes the NoteMore note when LimitPerDir left out entries of
+// dir.
+func (c *ContentWriter) EndDir(dir Entry, omitted int) {
+	c.prefetches[len(c.prefetches)-1].stop()
+	c.prefetches = c.prefetches[:len(c.prefetches)-1]
+	if omitted > 0 {
+		c.Note(Note{Kind: NoteMore, Path: dir.Path, Depth: dir.Depth, Omitted: omitted})
+	}
+}
+
+// WriteDir writes the header of dir, which was listed by other means than
+// Stream, or not at all.
+func (c *ContentWriter) WriteDir(dir Entry) {
+	c.render(c.r.Dir(c.w, c.describe(dir)))
+}
+
+// WriteFile writes the block of f, whose content was obtained by other
+// means than File, such as a cache.
+func (c *ContentWriter) WriteFile(f File) {
+	f.Entry = c.describe(f.Entry)
+	c.render(c.r.File(c.w, f))
+}
+
+// Note writes n.
+func (c *ContentWriter) Note(n Note) {
+	c.render(c.r.Note(c.w, n))
+}
+
+// render records the first error writing the output.
+func (c *ContentWriter) render(err error) {
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// describe returns e with its Meta told by Options.Describe.
+func (c *ContentWriter) describe(e Entry) Entry {
+	if c.opts.Describe != nil {
+		e.Meta = c.opts.Describe(e)
+	}
+	return e
+}
+
+// loadedFile is the content of a file read for a ContentWriter. release,
+// if not nil, must be called once the content is no longer needed.
+type loadedFile struct {
+	fsPath  string
+	content []byte
+	release func()
+	err     error
+}
+
+// load reads file with Options.Load, or from the analyzed file system.
+func (c *ContentWriter) load(file Entry) loadedFile {
+	if c.opts.Load != nil {
+		content, release, err := c.opts.Load(file)
+		return loadedFile{fsPath: file.fsPath, content: content, release: release, err: err}
+	}
+	content, err := file.ReadFile(0)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = fmt.Errorf("%w: %w", ErrChanged, err)
+	// A symlink's own size is that of its target path, not the content.
+	case err == nil && file.Info.Mode().IsRegular() && int64(len(content)) != file.Info.Size():
+		err = fmt.Errorf("%w: size changed from %d to %d bytes", ErrChanged, file.Info.Size(), len(content))
+	}
+	if err != nil {
+		return loadedFile{fsPath: file.fsPath, err: err}
+	}
+	return loadedFile{fsPath: file.fsPath, content: content}
+}
+
+// contentType returns the MIME type of the file at path with content,
+// with ContentType or as http.DetectContentType sees it.
+func (o Options) contentType(path string, content []byte) string {
+	if o.ContentType != nil {
+		return o.ContentType(path, content)
+	}
+	return http.DetectContentType(content)
+}
+
+// prefetcher reads the files of a directory ahead of a ContentWriter with
+// up to Concurrency reads in flight, handing them back in order.
+type prefetcher struct {
+	queue chan chan loadedFile
+	done  chan struct{}
+}
+
+// prefetch starts reading the files among entries in the background, or
+// returns nil when Concurrency doesn't allow concurrent reads.
+func (c *ContentWriter) prefetch(entries []Entry) *prefetcher {
+	var files []Entry
+	for _, e := range entries {
+		if e.Info != nil && !e.IsDir() {
+			files = append(files, e)
+		}
+	}
+	if c.opts.Concurrency <= 1 || len(files) < 2 {
+		return nil
+	}
+	p := &prefetcher{queue: make(chan chan loadedFile, c.opts.Concurrency-1), done: make(chan struct{})}
+	go func() {
+		defer close(p.queue)
+		for _, f := range files {
+			result := make(chan loadedFile, 1)
+			select {
+			case p.queue <- result:
+			case <-p.done:
+				return
+			case <-c.ctx.Done():
+				return
+			}
+			go func(f Entry) {
+				result <- c.load(f)
+			}(f)
+		}
+	}()
+	return p
+}
+
+// next returns the content of file, waiting for it to be read. Files read
+// ahead of it are released, as the caller skipped them. It returns nil on a
+// nil prefetcher, or once the reads were stopped, so the caller reads file
+// itself.
+func (p *prefetcher) next(file Entry) *loadedFile {
+	if p == nil {
+		return nil
+	}
+	for result := range p.queue {
+		loaded := <-result
+		if loaded.fsPath == file.fsPath {
+			return &loaded
+		}
+		if loaded.release != nil {
+			loaded.release()
+		}
+	}
+	return nil
+}
+
+// stop ends the reads of p and releases the files read but not used.
+func (p *prefetcher) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	for result := range p.queue {
+		if loaded := <-result; loaded.release != nil {
+			loaded.release()
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package apptree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWrite(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x.txt":   {Data: []byte("one\ntwo")},
+		"a/y.bin":   {Data: []byte{0, 1, 2}},
+		"empty.txt": {},
+	}
+	var b bytes.Buffer
+	if err := Write(context.Background(), &b, Options{Root: ".", FS: fsys, DirsFirst: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+DIRECTORY: .
+==========================
+
+DIRECTORY: a
+  ==========================
+
+FILE: a/x.txt
+TYPE: text/plain; charset=utf-8
+SIZE: 7 bytes
+CONTENT:
+    ==========================
+    one
+    two
+    ==========================
+
+FILE: a/y.bin
+TYPE: application/octet-stream
+SIZE: 3 bytes
+CONTENT:
+    ==========================
+    [Binary file content not displayed]
+    ==========================
+
+FILE: empty.txt
+TYPE: text/plain; charset=utf-8
+SIZE: 0 bytes
+CONTENT:
+  ==========================
+  [empty file]
+  ==========================
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x.txt": {Data: []byte("hi\n")},
+		"a/y.txt": {Data: []byte("skipped")},
+		"a/z.txt": {Data: []byte("omitted")},
+	}
+	opts := Options{
+		Root:        ".",
+		FS:          fsys,
+		Format:      FormatJSONL,
+		LimitPerDir: 2,
+		Prepare: func(f *File) bool {
+			f.HeaderOnly = f.Name == "y.txt"
+			return true
+		},
+	}
+	var b bytes.Buffer
+	if err := Write(context.Background(), &b, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"kind":"directory","path":"."}
+{"kind":"directory","path":"a"}
+{"kind":"file","path":"a/x.txt","type":"text/plain; charset=utf-8","size":3,"content":"hi\n"}
+{"kind":"file","path":"a/y.txt","type":"text/plain; charset=utf-8","size":7}
+{"kind":"more","path":"a","omitted":1}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestWriteConcurrency checks that files read ahead are written in order,
+// including when the caller skips some of them.
+func TestWriteConcurrency(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, name := range strings.Fields("a b c d e f g h") {
+		fsys["dir/"+name+".txt"] = &fstest.MapFile{Data: []byte(name)}
+	}
+	write := func(concurrency int) string {
+		var b bytes.Buffer
+		opts := Options{Root: ".", FS: fsys, Format: FormatJSONL, Concurrency: concurrency}
+		r, err := NewStreamRenderer(FormatJSONL, opts.Framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewContentWriter(context.Background(), &b, r, opts)
+		v := visitorFuncs{
+			dir: c.Dir,
+			file: func(e Entry) {
+				if e.Name != "c.txt" && e.Name != "f.txt" {
+					c.File(e)
+				}
+			},
+			endDir: c.EndDir,
+		}
+		if err := Stream(context.Background(), opts, v); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	want := write(1)
+	if strings.Contains(want, "c.txt") || !strings.Contains(want, `"content":"h"`) {
+		t.Fatalf("unexpected output\n%s", want)
+	}
+	for i := 0; i < 20; i++ {
+		if got := write(4); got != want {
+			t.Fatalf("with Concurrency 4 got\n%s\nwant\n%s", got, want)
+		}
+	}
+}
+
+func TestWriteChanged(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("abc")}}
+	var reported []string
+	opts := Options{
+		Root:   ".",
+		FS:     fsys,
+		Format: FormatJSONL,
+		Load: func(file Entry) ([]byte, func(), error) {
+			return nil, nil, ErrChanged
+		},
+		OnError: func(path string, err error) {
+			if errors.Is(err, ErrChanged) {
+				reported = append(reported, path)
+			}
+		},
+	}
+	var b bytes.Buffer
+	if err := Write(context.Background(), &b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `{"kind":"file","path":"a.txt","error":"file changed during scan"}`) {
+		t.Errorf("no changed note in\n%s", b.String())
+	}
+	if len(reported) != 1 || reported[0] != "a.txt" {
+		t.Errorf("OnError got %q, want [a.txt]", reported)
+	}
+}
+
+func TestNoteText(t *testing.T) {
+	n := Note{Kind: NoteText, Text: "a < b\n", Records: []Record{{Kind: "note", Path: "x"}}}
+	want := map[string]string{
+		FormatText:  "a < b\n",
+		FormatHTML:  "a &lt; b\n",
+		FormatJSONL: `{"kind":"note","path":"x"}` + "\n",
+	}
+	for format, text := range want {
+		r, err := NewStreamRenderer(format, Framing{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := r.Note(&b, n); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != text {
+			t.Errorf("%s wrote %q, want %q", format, b.String(), text)
+		}
+		if got := TextFramed(format); got != (format != FormatJSONL) {
+			t.Errorf("TextFramed(%q) = %v", format, got)
+		}
+	}
+}
+
+func TestNewStreamRendererUnknown(t *testing.T) {
+	if _, err := NewStreamRenderer("nope", Framing{}); err == nil {
+		t.Error("NewStreamRenderer accepted an unknown format")
+	}
+}
@@ -0,0 +1,118 @@
+package apptree_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// exampleTree creates a small project to analyze and returns its root.
+func exampleTree() string {
+	root, err := os.MkdirTemp("", "apptree-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"main.go":                  "package main\n",
+		"README.md":                "# demo\n",
+		"internal/store/store.go":  "package store\n",
+		"internal/store/store.pb":  "generated",
+		"node_modules/left/pad.js": "module.exports = 1\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return root
+}
+
+func ExampleNewOptions() {
+	root := exampleTree()
+	defer os.RemoveAll(root)
+
+	opts := apptree.NewOptions(root,
+		apptree.WithExcludes("node_modules", "*.pb"),
+		apptree.WithMaxDepth(3),
+		apptree.WithConcurrency(4),
+	)
+	tree, err := apptree.Analyze(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range tree.Files() {
+		rel, _ := filepath.Rel(root, file.Path)
+		fmt.Println(filepath.ToSlash(rel), file.Size)
+	}
+	// Output:
+	// README.md 7
+	// internal/store/store.go 14
+	// main.go 13
+}
+
+func ExampleRender() {
+	root := exampleTree()
+	defer os.RemoveAll(root)
+
+	opts := apptree.NewOptions(root,
+		apptree.WithExcludes("node_modules"),
+		apptree.WithFormat(apptree.FormatText),
+	)
+	tree, err := apptree.Analyze(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tree.Name = "demo"
+	if err := apptree.Render(os.Stdout, tree, opts.Format); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// demo/
+	//   README.md
+	//   internal/
+	//     store/
+	//       store.go
+	//       store.pb
+	//   main.go
+	//
+	// 2 directories, 4 files, 43 bytes
+}
+
+func ExampleRegister() {
+	// A renderer listing only the files, one path per line.
+	apptree.Register("paths", apptree.RendererFunc(func(w io.Writer, tree *apptree.Node, stats apptree.Stats) error {
+		for _, file := range tree.Files() {
+			rel, err := filepath.Rel(tree.Path, file.Path)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w, filepath.ToSlash(rel)); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%d files\n", stats.Files)
+		return err
+	}))
+
+	root := exampleTree()
+	defer os.RemoveAll(root)
+	tree, err := apptree.Analyze(apptree.NewOptions(root, apptree.WithExcludes("internal")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := apptree.Render(os.Stdout, tree, "paths"); err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// README.md
+	// main.go
+	// node_modules/left/pad.js
+	// 3 files
+}
@@ -0,0 +1,155 @@
+package apptree
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The reasons Options.Explain is given for the decisions of the filters
+// of this package. The reasons of Select are passed on as it gives them,
+// unless a later filter decides.
+const (
+	// ReasonSkip is given for entries Skip left out.
+	ReasonSkip = "skip"
+	// ReasonPin is given for files included by Pin.
+	ReasonPin = "pin"
+	// ReasonExclude is given for entries matching Exclude.
+	ReasonExclude = "exclude"
+	// ReasonEmpty is given for empty files left out by SkipEmpty.
+	ReasonEmpty = "empty"
+	// ReasonExcludeName is given for files matching ExcludeName.
+	ReasonExcludeName = "exclude-name"
+	// ReasonName is given for files included for matching Name, or left
+	// out for not matching it.
+	ReasonName = "name"
+	// ReasonType is given for files included by IncludeTypes, or left out
+	// by IncludeTypes or ExcludeTypes.
+	ReasonType = "type"
+	// ReasonFilter is given for entries Filter rejected.
+	ReasonFilter = "filter"
+	// ReasonNone is given for entries no filter decided on.
+	ReasonNone = ""
+)
+
+// Include reports whether the entry at path passes the filters, telling
+// Explain why, as for the entries of a walk.
+func (o Options) Include(path string, info fs.FileInfo) bool {
+	include, reason := o.decide(path, info)
+	if o.Explain != nil {
+		o.Explain(path, info, include, reason)
+	}
+	return include
+}
+
+// decide reports whether the entry at path below the root is included,
+// along with the reason.
+//
+// Entries rejected by Skip are left out first. Files matching Pin are then
+// included whatever the other filters say. Otherwise Exclude applies, then
+// Select, then, to files only, SkipEmpty, ExcludeName, Name and the type
+// filters, and finally Filter; an entry must pass all of them.
+func (o Options) decide(p string, info fs.FileInfo) (bool, string) {
+	if o.Skip != nil && o.Skip(p) {
+		return false, ReasonSkip
+	}
+	dir := info.IsDir()
+	if !dir && o.Pinned(p) {
+		return true, ReasonPin
+	}
+	if o.Excluded(info.Name()) {
+		return false, ReasonExclude
+	}
+	reason := ReasonNone
+	if o.Select != nil {
+		include, why := o.Select(p, info)
+		if !include {
+			return false, why
+		}
+		reason = why
+	}
+	if !dir {
+		if o.SkipEmpty && info.Size() == 0 {
+			return false, ReasonEmpty
+		}
+		name := info.Name()
+		// ExcludeName wins when both name filters match.
+		if o.ExcludeName != nil && o.ExcludeName.MatchString(name) {
+			return false, ReasonExcludeName
+		}
+		if o.Name != nil {
+			if !o.Name.MatchString(name) {
+				return false, ReasonName
+			}
+			reason = ReasonName
+		}
+		if len(o.IncludeTypes) > 0 || len(o.ExcludeTypes) > 0 {
+			if !o.matchesType(p) {
+				return false, ReasonType
+			}
+			if len(o.IncludeTypes) > 0 {
+				reason = ReasonType
+			}
+		}
+	}
+	if o.Filter != nil && !o.Filter(p, info) {
+		return false, ReasonFilter
+	}
+	return true, reason
+}
+
+// matchesType applies IncludeTypes and ExcludeTypes to the category of the
+// type of the file at p.
+func (o Options) matchesType(p string) bool {
+	category := Category(o.typeOf(p))
+	for _, t := range o.ExcludeTypes {
+		if strings.EqualFold(t, category) {
+			return false
+		}
+	}
+	if len(o.IncludeTypes) == 0 {
+		return true
+	}
+	for _, t := range o.IncludeTypes {
+		if strings.EqualFold(t, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the MIME type of the file at p with TypeOf, or guesses it
+// from the extension and the start of the file.
+func (o Options) typeOf(p string) string {
+	if o.TypeOf != nil {
+		return o.TypeOf(p)
+	}
+	if t := mime.TypeByExtension(filepath.Ext(p)); t != "" {
+		return t
+	}
+	var f fs.File
+	var err error
+	if o.FS != nil {
+		f, err = o.FS.Open(strings.TrimPrefix(p, o.PathPrefix))
+	} else {
+		f, err = os.Open(p)
+	}
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(f, header)
+	return http.DetectContentType(header[:n])
+}
+
+// Category returns the top-level category of mimeType, such as "image"
+// for "image/png".
+func Category(mimeType string) string {
+	category, _, _ := strings.Cut(mimeType, "/")
+	return category
+}
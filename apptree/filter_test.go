@@ -0,0 +1,110 @@
+package apptree
+
+import (
+	"context"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIncludeReasons(t *testing.T) {
+	fsys := fstest.MapFS{
+		"out.txt":      {Data: []byte("output")},
+		"keep.md":      {Data: []byte("# pinned")},
+		"skip.log":     {Data: []byte("log")},
+		"empty.go":     {},
+		"main.go":      {Data: []byte("package main")},
+		"main_test.go": {Data: []byte("package main")},
+		"notes.txt":    {Data: []byte("notes")},
+		"logo.png":     {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"gen.go":       {Data: []byte("package main")},
+	}
+	got := map[string]string{}
+	opts := Options{
+		Root:         ".",
+		FS:           fsys,
+		Skip:         func(path string) bool { return path == "out.txt" },
+		Pin:          []string{"*.md"},
+		Exclude:      []string{"*.log"},
+		SkipEmpty:    true,
+		Name:         regexp.MustCompile(`\.(go|txt|png)$`),
+		ExcludeName:  regexp.MustCompile(`_test\.go$`),
+		ExcludeTypes: []string{"image"},
+		Filter:       func(path string, info fs.FileInfo) bool { return path != "gen.go" },
+		Explain: func(path string, info fs.FileInfo, include bool, reason string) {
+			if include {
+				reason = "+" + reason
+			}
+			got[path] = reason
+		},
+	}
+	n, err := Count(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"out.txt":      ReasonSkip,
+		"keep.md":      "+" + ReasonPin,
+		"skip.log":     ReasonExclude,
+		"empty.go":     ReasonEmpty,
+		"main.go":      "+" + ReasonName,
+		"main_test.go": ReasonExcludeName,
+		"notes.txt":    "+" + ReasonName,
+		"logo.png":     ReasonType,
+		"gen.go":       ReasonFilter,
+	}
+	for path, reason := range want {
+		if got[path] != reason {
+			t.Errorf("%s: got reason %q, want %q", path, got[path], reason)
+		}
+	}
+	if n != 3 {
+		t.Errorf("Count = %d, want 3", n)
+	}
+}
+
+func TestIncludeSelect(t *testing.T) {
+	fsys := fstest.MapFS{"a/x.go": {}, "b/y.go": {}}
+	var included []string
+	opts := Options{
+		Root: ".",
+		FS:   fsys,
+		Select: func(path string, info fs.FileInfo) (bool, string) {
+			return !strings.HasPrefix(path, "b"), "picked"
+		},
+		Explain: func(path string, info fs.FileInfo, include bool, reason string) {
+			if include && reason == "picked" {
+				included = append(included, path)
+			}
+		},
+	}
+	if _, err := Count(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(included)
+	if strings.Join(included, " ") != "a a/x.go" {
+		t.Errorf("Select included %q, want [a a/x.go]", included)
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	fsys := fstest.MapFS{"dir/x.txt": {Data: []byte("x")}}
+	r := &recorder{}
+	opts := Options{Root: ".", FS: fsys, PathPrefix: "arch.zip!/"}
+	if err := Stream(context.Background(), opts, r); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"dir arch.zip!/ 0 [dir]",
+		"dir arch.zip!/dir 1 [x.txt]",
+		"file arch.zip!/dir/x.txt 2",
+		"end arch.zip!/dir 0",
+		"end arch.zip!/ 0",
+	}
+	if got := strings.Join(r.calls, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got calls\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,160 @@
+package apptree
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DefaultDelimiter is the line framing blocks when Framing.Delimiter is
+// empty.
+const DefaultDelimiter = "=========================="
+
+// DefaultFileHeader is the template of the classic FILE/TYPE/SIZE header,
+// plus the last commit when known, the extended attributes and a marker
+// for files kept in spite of a .gitignore file. Escape sequences are
+// written as \n, as on a command line.
+const DefaultFileHeader = `FILE: {{.Path}}{{if .Ignored}} [gitignored]{{end}}\nTYPE: {{.Type}}\nSIZE: {{.Size}} bytes{{if .Author}}\nLAST COMMIT: {{.Author}}, {{.Date}}{{end}}{{if .Xattrs}}\nXATTRS: {{.Xattrs}}{{end}}\nCONTENT:`
+
+// Framing configures how the stream renderers of this package frame
+// directories and files.
+type Framing struct {
+	// Delimiter separates the header of a block from its content and ends
+	// the block; DefaultDelimiter by default.
+	Delimiter string
+	// Header, if set, renders the header lines of a file block from its
+	// HeaderData; DefaultFileHeader by default.
+	Header *template.Template
+	// Minimal writes each file as a line holding its path followed by its
+	// content, without other framing.
+	Minimal bool
+	// OmitDirs leaves out the headers of directories that could be read.
+	OmitDirs bool
+	// Path, if set, formats the paths written.
+	Path func(path string) string
+	// Lines, if set, calls emit with each line of the text content of f
+	// the text framings write, and elide in place of lines left out. By
+	// default every line of the content is written.
+	Lines func(f File, emit func(line []byte), elide func(n int))
+	// Text, if set, returns the text content of f the record formats
+	// write; the content itself by default.
+	Text func(f File) string
+	// DataURISize, if positive, embeds binary files of up to that many
+	// bytes into the html format as data: URIs.
+	DataURISize int64
+}
+
+// HeaderData is the data Framing.Header renders the header of a file
+// from.
+type HeaderData struct {
+	Path    string
+	Name    string
+	Type    string
+	Size    int64
+	Author  string
+	Date    string
+	Ignored bool
+	Xattrs  string
+}
+
+// defaultHeader is DefaultFileHeader parsed.
+var defaultHeader = template.Must(ParseHeader(DefaultFileHeader))
+
+// escapeReplacer expands the escape sequences accepted in header
+// templates.
+var escapeReplacer = strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+
+// ParseHeader parses a template for Framing.Header, expanding the escape
+// sequences \n and \t.
+func ParseHeader(text string) (*template.Template, error) {
+	return template.New("file-header").Parse(escapeReplacer.Replace(text))
+}
+
+// FileHeader returns the header lines of the block of f, without the
+// delimiter that follows them.
+func (fr Framing) FileHeader(f File) string {
+	tmpl := fr.Header
+	if tmpl == nil {
+		tmpl = defaultHeader
+	}
+	data := HeaderData{
+		Path:    fr.path(f.Path),
+		Name:    filepath.Base(f.Path),
+		Type:    f.Type,
+		Size:    f.Size,
+		Author:  f.Meta.Author,
+		Date:    f.Meta.Date,
+		Ignored: f.Meta.Ignored,
+		Xattrs:  FormatXattrs(f.Meta.Xattrs),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "FILE: " + data.Path
+	}
+	return b.String()
+}
+
+// MinimalHeader returns the line written before the content of the file at
+// path with Minimal set.
+func (fr Framing) MinimalHeader(path string) string {
+	return "=== " + fr.path(path) + " ===\n"
+}
+
+// Indent returns the indentation of the blocks of entries depth levels
+// below their root.
+func Indent(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+func (fr Framing) delimiter() string {
+	if fr.Delimiter == "" {
+		return DefaultDelimiter
+	}
+	return fr.Delimiter
+}
+
+func (fr Framing) path(p string) string {
+	if fr.Path == nil {
+		return p
+	}
+	return fr.Path(p)
+}
+
+// lines calls emit with each line of the text content of f, applying
+// Lines.
+func (fr Framing) lines(f File, emit func(line []byte), elide func(n int)) {
+	if fr.Lines != nil {
+		fr.Lines(f, emit, elide)
+		return
+	}
+	content := f.Content
+	for {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			emit(content)
+			return
+		}
+		emit(content[:i])
+		content = content[i+1:]
+	}
+}
+
+// text returns the text content of f, applying Text.
+func (fr Framing) text(f File) string {
+	if fr.Text != nil {
+		return fr.Text(f)
+	}
+	return string(f.Content)
+}
+
+// FormatXattrs lists extended attributes as the default file header shows
+// them.
+func FormatXattrs(attrs []Xattr) string {
+	parts := make([]string, len(attrs))
+	for i, a := range attrs {
+		parts[i] = fmt.Sprintf("%s (%d bytes)", a.Name, a.Size)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,273 @@
+package apptree
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// htmlPageStart and htmlPageEnd frame the text rendering of the html
+// format, which is written escaped in between.
+const (
+	htmlPageStart = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>App Tree Analysis</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; padding: 20px; }
+        h1 { color: #333; }
+        h2 { color: #0066cc; }
+        h3 { color: #009900; }
+        pre { background-color: #f4f4f4; padding: 10px; border-radius: 5px; overflow-x: auto; }
+    </style>
+</head>
+<body>
+    <h1>App Tree Analysis</h1>
+    <pre>`
+	htmlPageEnd = `</pre>
+</body>
+</html>
+`
+)
+
+// HTMLPage returns text as the page of the html format, without the
+// markup the html renderer adds around files.
+func HTMLPage(text string) string {
+	return htmlPageStart + template.HTMLEscapeString(text) + htmlPageEnd
+}
+
+// htmlRenderer is the html format: the text format, escaped into a page
+// whose files are colored by type, with a legend linking to and filtering
+// them. Framing.DataURISize embeds small binary files.
+type htmlRenderer struct {
+	text textRenderer
+	// files counts the file blocks written, to give each an anchor.
+	files int
+	// typeAnchors maps each type to the anchor of its first file, which
+	// the legend links to, and typeCounts to the number of its files.
+	typeAnchors map[string]string
+	typeCounts  map[string]int
+	// markup holds the markup of the notes written at the end of the page.
+	markup []string
+}
+
+func newHTMLRenderer(fr Framing) *htmlRenderer {
+	return &htmlRenderer{
+		text:        textRenderer{framing: fr},
+		typeAnchors: map[string]string{},
+		typeCounts:  map[string]int{},
+	}
+}
+
+func (h *htmlRenderer) textFramed() {}
+
+// htmlState is the state of an htmlRenderer, for ResumableRenderer.
+type htmlState struct {
+	Files       int               `json:"files"`
+	TypeAnchors map[string]string `json:"type_anchors"`
+	TypeCounts  map[string]int    `json:"type_counts"`
+	Markup      []string          `json:"markup,omitempty"`
+}
+
+func (h *htmlRenderer) State() interface{} {
+	state := htmlState{
+		Files:       h.files,
+		TypeAnchors: make(map[string]string, len(h.typeAnchors)),
+		TypeCounts:  make(map[string]int, len(h.typeCounts)),
+		Markup:      append([]string(nil), h.markup...),
+	}
+	for t, anchor := range h.typeAnchors {
+		state.TypeAnchors[t] = anchor
+	}
+	for t, n := range h.typeCounts {
+		state.TypeCounts[t] = n
+	}
+	return state
+}
+
+func (h *htmlRenderer) Restore(data []byte) error {
+	var state htmlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	h.files, h.markup = state.Files, state.Markup
+	if state.TypeAnchors != nil {
+		h.typeAnchors = state.TypeAnchors
+	}
+	if state.TypeCounts != nil {
+		h.typeCounts = state.TypeCounts
+	}
+	return nil
+}
+
+func (h *htmlRenderer) Begin(w io.Writer) error {
+	_, err := io.WriteString(w, htmlPageStart)
+	return err
+}
+
+func (h *htmlRenderer) End(w io.Writer) error {
+	end := h.renderTypeLegend() + strings.Join(h.markup, "")
+	_, err := io.WriteString(w, strings.Replace(htmlPageEnd, "</body>", end+"</body>", 1))
+	return err
+}
+
+func (h *htmlRenderer) Dir(w io.Writer, dir Entry) error {
+	var b bytes.Buffer
+	h.text.Dir(&b, dir)
+	return writeEscaped(w, b.Bytes())
+}
+
+// File wraps the block of f in an element the legend can color, link to
+// and filter, dimming gitignored files.
+func (h *htmlRenderer) File(w io.Writer, f File) error {
+	h.files++
+	id := fmt.Sprintf("file-%d", h.files)
+	if _, ok := h.typeAnchors[f.Type]; !ok {
+		h.typeAnchors[f.Type] = id
+	}
+	h.typeCounts[f.Type]++
+	class := "file " + typeClass(f.Type)
+	if f.Meta.Ignored {
+		class += " gitignored"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<span class="%s" id="%s">`, class, id)
+	if h.embeds(f) {
+		template.HTMLEscape(&b, []byte(h.text.head(f)+Indent(f.Depth)))
+		b.WriteString(dataURITag(f.Path, f.Type, f.Content) + "\n")
+		template.HTMLEscape(&b, []byte(h.text.tail(f)))
+	} else {
+		template.HTMLEscape(&b, []byte(h.text.head(f)+h.text.body(f)+h.text.tail(f)))
+	}
+	b.WriteString("</span>")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// embeds reports whether the content of f is embedded as a data: URI.
+func (h *htmlRenderer) embeds(f File) bool {
+	size := h.text.framing.DataURISize
+	return size > 0 && !h.text.framing.Minimal && !f.HeaderOnly && !f.IsText() && f.Size > 0 && f.Size <= size
+}
+
+// Note writes notes as the text format does, except that the Markup of a
+// NoteText is kept for the end of the page.
+func (h *htmlRenderer) Note(w io.Writer, n Note) error {
+	if n.Kind == NoteText && n.Markup != "" {
+		h.markup = append(h.markup, n.Markup)
+		return nil
+	}
+	var b bytes.Buffer
+	h.text.Note(&b, n)
+	return writeEscaped(w, b.Bytes())
+}
+
+// writeEscaped writes text to w escaped for the page body.
+func writeEscaped(w io.Writer, text []byte) error {
+	var b bytes.Buffer
+	template.HTMLEscape(&b, text)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// dataURITag returns an HTML element embedding content as a data: URI: an
+// inline image for images, a download link for anything else.
+func dataURITag(file, fileType string, content []byte) string {
+	if fileType == "unknown" {
+		fileType = "application/octet-stream"
+	}
+	uri := fmt.Sprintf("data:%s;base64,%s", fileType, base64.StdEncoding.EncodeToString(content))
+	name := template.HTMLEscapeString(filepath.Base(file))
+
+	if strings.HasPrefix(fileType, "image/") {
+		return fmt.Sprintf(`<img src="%s" alt="%s" style="max-width: 100%%;">`, uri, name)
+	}
+	return fmt.Sprintf(`<a href="%s" download="%s">Download %s</a>`, uri, name, name)
+}
+
+// typeClass returns the CSS class marking files of fileType.
+func typeClass(fileType string) string {
+	var b strings.Builder
+	b.WriteString("type-")
+	for _, r := range strings.ToLower(fileType) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// typeColor returns a color for fileType that stays the same between runs.
+func typeColor(fileType string) string {
+	h := fnv.New32a()
+	h.Write([]byte(fileType))
+	return fmt.Sprintf("hsl(%d, 65%%, 45%%)", h.Sum32()%360)
+}
+
+// renderTypeLegend returns a sidebar listing the detected file types with
+// their counts and colors, most common first. Each entry links to the first
+// file of its type, and clicking it shows only files of that type.
+func (h *htmlRenderer) renderTypeLegend() string {
+	if len(h.typeCounts) == 0 {
+		return ""
+	}
+	counts := h.typeCounts
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+
+	var b strings.Builder
+	b.WriteString("    <style>\n")
+	b.WriteString("        .file { display: block; border-left: 4px solid transparent; padding-left: 6px; }\n")
+	b.WriteString("        .file.hidden { display: none; }\n")
+	b.WriteString("        .file.gitignored { opacity: 0.5; }\n")
+	b.WriteString("        #legend { position: fixed; top: 20px; right: 20px; max-height: 80vh; overflow-y: auto; background: #fff; border: 1px solid #ddd; border-radius: 5px; padding: 10px; font-size: 14px; }\n")
+	b.WriteString("        #legend ul { list-style: none; margin: 0; padding: 0; }\n")
+	b.WriteString("        #legend a { color: #333; text-decoration: none; }\n")
+	b.WriteString("        #legend .swatch { display: inline-block; width: 10px; height: 10px; margin-right: 6px; }\n")
+	for _, t := range types {
+		fmt.Fprintf(&b, "        .%s { border-left-color: %s; }\n", typeClass(t), typeColor(t))
+	}
+	b.WriteString("    </style>\n")
+
+	b.WriteString("    <nav id=\"legend\">\n        <h3>File types</h3>\n        <ul>\n")
+	for _, t := range types {
+		fmt.Fprintf(&b, "            <li><a href=\"#%s\" data-type=\"%s\"><span class=\"swatch\" style=\"background: %s;\"></span>%s (%d)</a></li>\n",
+			h.typeAnchors[t], typeClass(t), typeColor(t), template.HTMLEscapeString(t), counts[t])
+	}
+	b.WriteString("            <li><a href=\"#\" data-type=\"\">Show all</a></li>\n")
+	b.WriteString("        </ul>\n    </nav>\n")
+
+	b.WriteString(`    <script>
+        document.querySelectorAll('#legend a').forEach(function (link) {
+            link.addEventListener('click', function () {
+                var type = link.dataset.type;
+                document.querySelectorAll('.file').forEach(function (file) {
+                    file.classList.toggle('hidden', type !== '' && !file.classList.contains(type));
+                });
+            });
+        });
+    </script>
+`)
+	return b.String()
+}
@@ -0,0 +1,71 @@
+// Package apptree analyzes directory trees. Analyze walks a root in the
+// operating system's file system or in any fs.FS, such as an embedded file
+// system or an fstest.MapFS, applying the filters of its Options, and
+// returns the selected files and directories as a tree of Nodes, which the
+// Renderers registered in this package write out as text, JSON, HTML or
+// Markdown. Stream walks a root the same way but hands each entry to a
+// Visitor as it is met, for output written during the walk.
+//
+// The app-tree command builds on this package and adds the content
+// rendering, caching and serving features of its CLI.
+package apptree
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Node is a file or directory found by Analyze.
+type Node struct {
+	// Name is the base name of the entry and Path the path it was found
+	// at, starting with the root given to Analyze, or within Options.FS
+	// when one is given.
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+	// Size is the size of a file in bytes, or the total size of the files
+	// below a directory.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Info is the entry's file info as returned by Lstat, so symbolic links
+	// are reported as links.
+	Info     fs.FileInfo `json:"-"`
+	Children []*Node     `json:"children,omitempty"`
+	// Err is the error reading the entry or, for a directory, listing it.
+	// Nodes whose info couldn't be read have a nil Info.
+	Err error `json:"-"`
+	// Partial marks a tree, or a directory within it, that is incomplete
+	// because the analysis was cancelled.
+	Partial bool `json:"partial,omitempty"`
+
+	// fsys is the analyzed file system and fsPath the slash-separated path
+	// of the entry within it.
+	fsys   fs.FS
+	fsPath string
+}
+
+// Entry returns n as an entry at the root of a walk, whose content can be
+// read, so a ContentWriter can write it.
+func (n *Node) Entry() Entry {
+	return Entry{Name: n.Name, Path: n.Path, Info: n.Info, Err: n.Err, fsys: n.fsys, fsPath: n.fsPath}
+}
+
+// Walk calls fn for n and every node below it, parents before their
+// children and siblings in order.
+func (n *Node) Walk(fn func(n *Node)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// Files returns the files below n, in the order Walk visits them.
+func (n *Node) Files() []*Node {
+	var files []*Node
+	n.Walk(func(n *Node) {
+		if !n.Dir && n.Info != nil {
+			files = append(files, n)
+		}
+	})
+	return files
+}
@@ -0,0 +1,98 @@
+package apptree
+
+import "io/fs"
+
+// Option sets a field of Options. Options are applied in order, so later
+// ones override earlier ones.
+type Option func(*Options)
+
+// NewOptions returns the Options for analyzing root with opts applied.
+func NewOptions(root string, opts ...Option) Options {
+	o := Options{Root: root}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithExcludes adds base-name glob patterns of entries to leave out.
+func WithExcludes(patterns ...string) Option {
+	return func(o *Options) {
+		o.Exclude = append(o.Exclude, patterns...)
+	}
+}
+
+// WithMaxDepth limits the walk to n levels below the root; 0 removes the
+// limit.
+func WithMaxDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxDepth = n
+	}
+}
+
+// WithConcurrency lists up to n directories at once.
+func WithConcurrency(n int) Option {
+	return func(o *Options) {
+		o.Concurrency = n
+	}
+}
+
+// WithFormat selects the registered format Render produces.
+func WithFormat(format string) Option {
+	return func(o *Options) {
+		o.Format = format
+	}
+}
+
+// WithFilter sets the function deciding which entries below the root are
+// included.
+func WithFilter(filter func(path string, info fs.FileInfo) bool) Option {
+	return func(o *Options) {
+		o.Filter = filter
+	}
+}
+
+// WithDescend sets the function deciding which included directories are
+// walked into.
+func WithDescend(descend func(path string) bool) Option {
+	return func(o *Options) {
+		o.Descend = descend
+	}
+}
+
+// WithSort orders the entries of each directory by SortName, SortSize or
+// SortModTime.
+func WithSort(by string) Option {
+	return func(o *Options) {
+		o.SortBy = by
+	}
+}
+
+// WithDirsFirst lists directories before files.
+func WithDirsFirst() Option {
+	return func(o *Options) {
+		o.DirsFirst, o.FilesFirst = true, false
+	}
+}
+
+// WithFilesFirst lists files before directories.
+func WithFilesFirst() Option {
+	return func(o *Options) {
+		o.DirsFirst, o.FilesFirst = false, true
+	}
+}
+
+// WithLimitPerDir keeps at most n entries of each directory; 0 removes the
+// limit.
+func WithLimitPerDir(n int) Option {
+	return func(o *Options) {
+		o.LimitPerDir = n
+	}
+}
+
+// WithPins adds glob patterns of entries kept beyond the LimitPerDir.
+func WithPins(patterns ...string) Option {
+	return func(o *Options) {
+		o.Pin = append(o.Pin, patterns...)
+	}
+}
@@ -0,0 +1,291 @@
+package apptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats registered by this package.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+// Stats summarizes a tree for renderers.
+type Stats struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Size  int64 `json:"size"`
+	// Errors counts the entries that couldn't be read or listed.
+	Errors  int  `json:"errors"`
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Summarize returns the Stats of the tree below root, not counting root
+// itself.
+func Summarize(root *Node) Stats {
+	stats := Stats{Size: root.Size, Partial: root.Partial}
+	root.Walk(func(n *Node) {
+		if n.Err != nil {
+			stats.Errors++
+		}
+		switch {
+		case n == root || n.Info == nil:
+		case n.Dir:
+			stats.Dirs++
+		default:
+			stats.Files++
+		}
+	})
+	return stats
+}
+
+// A Renderer writes a tree in one output format.
+type Renderer interface {
+	Render(w io.Writer, tree *Node, stats Stats) error
+}
+
+// RendererFunc adapts a function to a Renderer.
+type RendererFunc func(w io.Writer, tree *Node, stats Stats) error
+
+// Render calls f(w, tree, stats).
+func (f RendererFunc) Render(w io.Writer, tree *Node, stats Stats) error {
+	return f(w, tree, stats)
+}
+
+var renderers = map[string]Renderer{}
+
+func init() {
+	Register(FormatText, RendererFunc(renderText))
+	Register(FormatJSON, subtreeRenderer{jsonTree{}})
+	Register(FormatHTML, subtreeRenderer{htmlTree{}})
+	Register(FormatMarkdown, RendererFunc(renderMarkdown))
+}
+
+// Register makes r available as format. It panics if the name is already
+// taken, so formats can't be replaced by accident.
+func Register(format string, r Renderer) {
+	if _, ok := renderers[format]; ok {
+		panic(fmt.Sprintf("apptree: renderer %q registered twice", format))
+	}
+	renderers[format] = r
+}
+
+// Lookup returns the renderer registered as format.
+func Lookup(format string) (Renderer, bool) {
+	r, ok := renderers[format]
+	return r, ok
+}
+
+// Formats returns the names of the registered formats in order.
+func Formats() []string {
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render writes root with the renderer registered as format; an empty
+// format renders text.
+func Render(w io.Writer, root *Node, format string) error {
+	if format == "" {
+		format = FormatText
+	}
+	r, ok := Lookup(format)
+	if !ok {
+		return fmt.Errorf("apptree: unknown format %q", format)
+	}
+	return r.Render(w, root, Summarize(root))
+}
+
+// RenderText writes root as an indented listing with one entry per line,
+// directories marked by a trailing slash, like the structure section of the
+// app-tree output.
+func RenderText(w io.Writer, root *Node) error {
+	bw := bufio.NewWriter(w)
+	writeText(bw, root)
+	return bw.Flush()
+}
+
+func writeText(w io.Writer, root *Node) {
+	var write func(n *Node, indent string)
+	write = func(n *Node, indent string) {
+		if n.Dir {
+			fmt.Fprintf(w, "%s%s/\n", indent, n.Name)
+		} else {
+			fmt.Fprintf(w, "%s%s\n", indent, n.Name)
+		}
+		for _, child := range n.Children {
+			write(child, indent+"  ")
+		}
+	}
+	write(root, "")
+}
+
+// RenderJSON writes root as an indented JSON object with the children of
+// directories nested in them.
+func RenderJSON(w io.Writer, root *Node) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(root)
+}
+
+// renderText is the text format: the listing of RenderText followed by the
+// totals.
+func renderText(w io.Writer, tree *Node, stats Stats) error {
+	bw := bufio.NewWriter(w)
+	writeText(bw, tree)
+	fmt.Fprintf(bw, "\n%s\n", describeStats(stats))
+	return bw.Flush()
+}
+
+// jsonTree is the json format: an object holding the stats and the tree,
+// indented as by an Encoder with SetIndent("", "  ").
+type jsonTree struct{}
+
+// jsonIndent returns the indentation of the lines of a node at depth, 0
+// being the tree.
+func jsonIndent(depth int) string {
+	return "  " + strings.Repeat("    ", depth)
+}
+
+func (jsonTree) open(w io.Writer, dir *Node, depth int, stats Stats) error {
+	if depth == 0 {
+		data, err := json.MarshalIndent(stats, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "{\n  \"stats\": %s,\n  \"tree\": ", data)
+	}
+	// The fields before the children are those of dir without them, and
+	// partial, the only one after them, is written by close.
+	head := *dir
+	head.Children, head.Partial = nil, false
+	indent := jsonIndent(depth)
+	data, err := json.MarshalIndent(&head, indent, "  ")
+	if err != nil {
+		return err
+	}
+	w.Write(bytes.TrimSuffix(data, []byte("\n"+indent+"}")))
+	if len(dir.Children) > 0 {
+		fmt.Fprintf(w, ",\n%s  \"children\": [\n%s", indent, jsonIndent(depth+1))
+	}
+	return nil
+}
+
+func (jsonTree) sep(w io.Writer, depth int) {
+	io.WriteString(w, ",\n"+jsonIndent(depth))
+}
+
+func (jsonTree) close(w io.Writer, dir *Node, depth int, stats Stats) {
+	indent := jsonIndent(depth)
+	if len(dir.Children) > 0 {
+		io.WriteString(w, "\n"+indent+"  ]")
+	}
+	if dir.Partial {
+		io.WriteString(w, ",\n"+indent+"  \"partial\": true")
+	}
+	io.WriteString(w, "\n"+indent+"}")
+	if depth == 0 {
+		io.WriteString(w, "\n}\n")
+	}
+}
+
+func (jsonTree) node(w io.Writer, n *Node, depth int) error {
+	data, err := json.MarshalIndent(n, jsonIndent(depth), "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// htmlTree is the html format: a standalone page with the tree as nested
+// lists.
+type htmlTree struct{}
+
+// htmlIndent returns the indentation of the list item of a node at depth,
+// the children of the tree being at depth 1.
+func htmlIndent(depth int) string {
+	return strings.Repeat("  ", depth-1)
+}
+
+func (htmlTree) open(w io.Writer, dir *Node, depth int, stats Stats) error {
+	if depth == 0 {
+		title := html.EscapeString(dir.Name)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n<ul>\n", title, title)
+		return nil
+	}
+	indent := htmlIndent(depth)
+	fmt.Fprintf(w, "%s<li>%s/\n%s<ul>\n", indent, html.EscapeString(dir.Name), indent)
+	return nil
+}
+
+func (htmlTree) sep(w io.Writer, depth int) {}
+
+func (htmlTree) close(w io.Writer, dir *Node, depth int, stats Stats) {
+	if depth == 0 {
+		fmt.Fprintf(w, "</ul>\n<p>%s</p>\n</body>\n</html>\n", html.EscapeString(describeStats(stats)))
+		return
+	}
+	indent := htmlIndent(depth)
+	fmt.Fprintf(w, "%s</ul>\n%s</li>\n", indent, indent)
+}
+
+func (h htmlTree) node(w io.Writer, n *Node, depth int) error {
+	if !n.Dir {
+		fmt.Fprintf(w, "%s<li>%s</li>\n", htmlIndent(depth), html.EscapeString(n.Name))
+		return nil
+	}
+	h.open(w, n, depth, Stats{})
+	for _, child := range n.Children {
+		h.node(w, child, depth+1)
+	}
+	h.close(w, n, depth, Stats{})
+	return nil
+}
+
+// renderMarkdown is the markdown format: a heading and the tree as a nested
+// bullet list.
+func renderMarkdown(w io.Writer, tree *Node, stats Stats) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n\n", tree.Name)
+	var write func(n *Node, indent string)
+	write = func(n *Node, indent string) {
+		name := n.Name
+		if n.Dir {
+			name += "/"
+		}
+		fmt.Fprintf(bw, "%s- `%s`\n", indent, strings.ReplaceAll(name, "`", "'"))
+		for _, child := range n.Children {
+			write(child, indent+"  ")
+		}
+	}
+	for _, child := range tree.Children {
+		write(child, "")
+	}
+	fmt.Fprintf(bw, "\n%s\n", describeStats(stats))
+	return bw.Flush()
+}
+
+// describeStats returns a line summarizing stats.
+func describeStats(stats Stats) string {
+	s := fmt.Sprintf("%d directories, %d files, %d bytes", stats.Dirs, stats.Files, stats.Size)
+	if stats.Errors > 0 {
+		s += fmt.Sprintf(", %d errors", stats.Errors)
+	}
+	if stats.Partial {
+		s += " (partial: the analysis was cancelled)"
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package apptree
+
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// Entry is a file or directory met by Stream.
+type Entry struct {
+	// Name and Path are as for Node.
+	Name string
+	Path string
+	// Info is the entry's file info as returned by Lstat, or nil when it
+	// couldn't be read.
+	Info fs.FileInfo
+	// Depth is how many levels below the root the entry is.
+	Depth int
+	// Err is the error reading the entry's info or, for a directory,
+	// listing it.
+	Err error
+	// Meta is what Options.Describe tells about the entry, set for the
+	// renderer of a ContentWriter.
+	Meta Meta
+
+	fsys   fs.FS
+	fsPath string
+}
+
+// IsDir reports whether e is a directory.
+func (e Entry) IsDir() bool {
+	return e.Info != nil && e.Info.IsDir()
+}
+
+// Open opens the entry in the analyzed file system.
+func (e Entry) Open() (fs.File, error) {
+	return e.fsys.Open(e.fsPath)
+}
+
+// ReadFile returns the content of the entry, reading at most limit bytes
+// when limit is positive.
+func (e Entry) ReadFile(limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return fs.ReadFile(e.fsys, e.fsPath)
+	}
+	f, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
+
+// A Visitor receives the entries met by Stream in output order: a
+// directory, then each of its entries in turn, then the end of the
+// directory.
+type Visitor interface {
+	// Dir is called for every directory, the root included, with the
+	// entries visited next. A directory that couldn't be listed has its
+	// Err set; it has no entries then, and neither has one beyond MaxDepth
+	// or rejected by Descend.
+	Dir(dir Entry, entries []Entry)
+	// File is called for every other entry, including those whose info
+	// couldn't be read.
+	File(file Entry)
+	// EndDir is called after the entries of dir, with the number of
+	// entries LimitPerDir left out.
+	EndDir(dir Entry, omitted int)
+}
+
+// Stream walks opts.Root like Analyze, calling v for every entry as it is
+// met rather than building a tree, so output can be written while the walk
+// proceeds. It walks sequentially whatever opts.Concurrency is. When ctx is
+// done, the walk stops and Stream returns ctx.Err().
+func Stream(ctx context.Context, opts Options, v Visitor) error {
+	a, root, err := newAnalysis(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if root.IsDir() {
+		a.stream(root, v)
+	} else {
+		v.File(root)
+	}
+	if ctx.Err() != nil && a.stopped {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// stream visits the directory dir and the entries below it.
+func (a *analysis) stream(dir Entry, v Visitor) {
+	var entries []Entry
+	omitted := 0
+	if a.opts.descends(dir) {
+		if a.ctx.Err() != nil {
+			a.stopped = true
+		} else {
+			entries, omitted, dir.Err = a.list(dir)
+		}
+	}
+
+	v.Dir(dir, entries)
+	for _, e := range entries {
+		if a.ctx.Err() != nil {
+			a.stopped = true
+			break
+		}
+		if e.IsDir() {
+			a.stream(e, v)
+		} else {
+			v.File(e)
+		}
+	}
+	v.EndDir(dir, omitted)
+}
+
+// Count returns the number of entries below opts.Root that Stream visits,
+// applying the same filters and limits.
+func Count(ctx context.Context, opts Options) (int, error) {
+	var c counter
+	err := Stream(ctx, opts, &c)
+	return c.n, err
+}
+
+// counter is the Visitor of Count.
+type counter struct {
+	n int
+}
+
+func (c *counter) Dir(dir Entry, entries []Entry) {
+	for _, e := range entries {
+		if e.Info != nil {
+			c.n++
+		}
+	}
+}
+
+func (c *counter) File(file Entry)               {}
+func (c *counter) EndDir(dir Entry, omitted int) {}
@@ -0,0 +1,107 @@
+package apptree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// recorder is a Visitor logging the calls it gets.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) Dir(dir Entry, entries []Entry) {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	r.calls = append(r.calls, fmt.Sprintf("dir %s %d [%s]", dir.Path, dir.Depth, strings.Join(names, " ")))
+}
+
+func (r *recorder) File(file Entry) {
+	r.calls = append(r.calls, fmt.Sprintf("file %s %d", file.Path, file.Depth))
+}
+
+func (r *recorder) EndDir(dir Entry, omitted int) {
+	r.calls = append(r.calls, fmt.Sprintf("end %s %d", dir.Path, omitted))
+}
+
+func TestStream(t *testing.T) {
+	fsys := fstest.MapFS{
+		"b.txt":       {Data: []byte("bb")},
+		"a/1.txt":     {Data: []byte("1")},
+		"a/2.txt":     {Data: []byte("2")},
+		"a/3.txt":     {Data: []byte("3")},
+		"a/deep/x.go": {Data: []byte("x")},
+	}
+	r := &recorder{}
+	opts := Options{Root: ".", FS: fsys, DirsFirst: true, LimitPerDir: 2, Exclude: []string{"deep"}}
+	if err := Stream(context.Background(), opts, r); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"dir . 0 [a b.txt]",
+		"dir a 1 [1.txt 2.txt]",
+		"file a/1.txt 2",
+		"file a/2.txt 2",
+		"end a 1",
+		"file b.txt 1",
+		"end . 0",
+	}
+	if got := strings.Join(r.calls, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got calls\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamReadFile(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("hello")}}
+	var got []string
+	v := visitorFuncs{file: func(e Entry) {
+		content, err := e.ReadFile(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(content))
+	}}
+	if err := Stream(context.Background(), Options{Root: ".", FS: fsys}, v); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "hell" {
+		t.Errorf("read %q, want [hell]", got)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	fsys := fstest.MapFS{"a/x": {}, "b/y": {}}
+	ctx, cancel := context.WithCancel(context.Background())
+	v := visitorFuncs{file: func(Entry) { cancel() }}
+	if err := Stream(ctx, Options{Root: ".", FS: fsys}, v); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream returned %v, want context.Canceled", err)
+	}
+}
+
+// visitorFuncs is a Visitor calling file for every file, and dir and
+// endDir, when set, for every directory.
+type visitorFuncs struct {
+	dir    func(Entry, []Entry)
+	file   func(Entry)
+	endDir func(Entry, int)
+}
+
+func (v visitorFuncs) Dir(dir Entry, entries []Entry) {
+	if v.dir != nil {
+		v.dir(dir, entries)
+	}
+}
+
+func (v visitorFuncs) File(e Entry) { v.file(e) }
+
+func (v visitorFuncs) EndDir(dir Entry, omitted int) {
+	if v.endDir != nil {
+		v.endDir(dir, omitted)
+	}
+}
@@ -0,0 +1,313 @@
+package apptree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats registered as stream renderers by this package, besides
+// FormatText and FormatHTML.
+const (
+	FormatJSONL = "jsonl"
+)
+
+// A StreamRenderer writes the output of a ContentWriter in one format as
+// the walk proceeds. Its methods are called from one goroutine, in output
+// order, between Begin and End.
+type StreamRenderer interface {
+	// Begin writes the start of the document and End its end.
+	Begin(w io.Writer) error
+	End(w io.Writer) error
+	// Dir writes the header of a directory, or the note that it couldn't be
+	// read for lack of permission when dir.Err is set.
+	Dir(w io.Writer, dir Entry) error
+	// File writes the block of a file.
+	File(w io.Writer, f File) error
+	// Note writes a remark among the blocks.
+	Note(w io.Writer, n Note) error
+}
+
+// A ResumableRenderer is a StreamRenderer whose output depends on what it
+// wrote before, as the anchors and type legend of html do. Its state is
+// saved along with an output written in part, so that another renderer can
+// continue the output.
+type ResumableRenderer interface {
+	StreamRenderer
+	// State returns a copy of the state, which encodes as JSON, and Restore
+	// sets the state from that encoding.
+	State() interface{}
+	Restore(data []byte) error
+}
+
+// streamRenderers maps formats to the functions creating their renderers.
+var streamRenderers = map[string]func(Framing) StreamRenderer{}
+
+func init() {
+	RegisterStream(FormatText, func(fr Framing) StreamRenderer { return &textRenderer{framing: fr} })
+	RegisterStream(FormatHTML, func(fr Framing) StreamRenderer { return newHTMLRenderer(fr) })
+	RegisterStream(FormatJSONL, func(fr Framing) StreamRenderer { return &jsonlRenderer{framing: fr} })
+}
+
+// RegisterStream makes the renderers newRenderer returns available as
+// format. A renderer is created for every output, so it may keep state
+// between its calls. It panics if the name is already taken.
+func RegisterStream(format string, newRenderer func(Framing) StreamRenderer) {
+	if _, ok := streamRenderers[format]; ok {
+		panic(fmt.Sprintf("apptree: stream renderer %q registered twice", format))
+	}
+	streamRenderers[format] = newRenderer
+}
+
+// NewStreamRenderer returns a renderer of the stream format with framing.
+func NewStreamRenderer(format string, framing Framing) (StreamRenderer, error) {
+	newRenderer, ok := streamRenderers[format]
+	if !ok {
+		return nil, fmt.Errorf("apptree: unknown stream format %q", format)
+	}
+	return newRenderer(framing), nil
+}
+
+// TextFramed reports whether the renderers of the stream format write the
+// text framing, in which the Text of notes appears, as text and html do.
+func TextFramed(format string) bool {
+	r, err := NewStreamRenderer(format, Framing{})
+	if err != nil {
+		return false
+	}
+	_, ok := r.(textFramer)
+	return ok
+}
+
+// textFramer is implemented by the renderers writing the text framing.
+type textFramer interface {
+	textFramed()
+}
+
+// StreamFormats returns the names of the registered stream formats in
+// order.
+func StreamFormats() []string {
+	formats := make([]string, 0, len(streamRenderers))
+	for format := range streamRenderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ElisionMarker replaces the lines Framing.Lines leaves out.
+const ElisionMarker = "[...]"
+
+// invalidUTF8Marker notes text content whose invalid UTF-8 was replaced.
+const invalidUTF8Marker = "[contains invalid UTF-8]"
+
+// changedMarker takes the place of the content of a file that changed
+// during the walk.
+const changedMarker = "[file changed during scan]"
+
+// textRenderer is the text format: a block per directory and file, framed
+// by the delimiter and indented by depth, or with Framing.Minimal a path
+// line before the content of each file.
+type textRenderer struct {
+	framing Framing
+}
+
+func (t *textRenderer) textFramed() {}
+
+func (t *textRenderer) Begin(w io.Writer) error { return nil }
+func (t *textRenderer) End(w io.Writer) error   { return nil }
+
+func (t *textRenderer) Dir(w io.Writer, dir Entry) error {
+	fr := t.framing
+	indent := Indent(dir.Depth)
+	switch {
+	case dir.Err != nil && fr.Minimal:
+		_, err := io.WriteString(w, fr.MinimalHeader(dir.Path)+"[permission denied]\n")
+		return err
+	case dir.Err != nil:
+		_, err := fmt.Fprintf(w, "\nDIRECTORY: %s\n%s%s\n%s[permission denied]\n", fr.path(dir.Path), indent, fr.delimiter(), indent)
+		return err
+	case fr.Minimal:
+		// Directories are implied by the file paths.
+		return nil
+	}
+	name := fr.path(dir.Path)
+	if dir.Meta.Size != nil {
+		name += fmt.Sprintf(" (%d bytes)", *dir.Meta.Size)
+	}
+	if dir.Meta.Submodule {
+		name += " [submodule]"
+	}
+	if dir.Meta.Ignored {
+		name += " [gitignored]"
+	}
+	_, err := fmt.Fprintf(w, "\nDIRECTORY: %s\n%s%s\n", name, indent, fr.delimiter())
+	return err
+}
+
+func (t *textRenderer) File(w io.Writer, f File) error {
+	_, err := io.WriteString(w, t.head(f)+t.body(f)+t.tail(f))
+	return err
+}
+
+// head returns the start of the block of f, up to its content.
+func (t *textRenderer) head(f File) string {
+	if t.framing.Minimal {
+		return t.framing.MinimalHeader(f.Path)
+	}
+	return fmt.Sprintf("\n%s\n%s%s\n", t.framing.FileHeader(f), Indent(f.Depth), t.framing.delimiter())
+}
+
+// tail returns the end of the block of f, after its content.
+func (t *textRenderer) tail(f File) string {
+	if t.framing.Minimal {
+		return ""
+	}
+	return Indent(f.Depth) + t.framing.delimiter() + "\n"
+}
+
+// body returns the content of the block of f.
+func (t *textRenderer) body(f File) string {
+	var b strings.Builder
+	indent := Indent(f.Depth)
+	if t.framing.Minimal {
+		indent = ""
+	}
+	switch {
+	case t.framing.Minimal && (f.HeaderOnly || f.Size == 0 || f.IsText() && len(f.Content) == 0):
+	case f.Size == 0:
+		b.WriteString(indent + "[empty file]\n")
+	case f.HeaderOnly:
+		b.WriteString(indent + "[content omitted by rule]\n")
+	case f.IsText():
+		if f.InvalidUTF8 && !t.framing.Minimal {
+			b.WriteString(indent + invalidUTF8Marker + "\n")
+		}
+		t.framing.lines(f, func(line []byte) {
+			b.WriteString(indent)
+			b.Write(line)
+			b.WriteString("\n")
+		}, func(n int) {
+			b.WriteString(indent + ElisionMarker + "\n")
+		})
+	default:
+		b.WriteString(indent + "[Binary file content not displayed]\n")
+	}
+	return b.String()
+}
+
+func (t *textRenderer) Note(w io.Writer, n Note) error {
+	fr := t.framing
+	indent := Indent(n.Depth)
+	var s string
+	switch n.Kind {
+	case NoteMore:
+		if fr.Minimal {
+			s = fmt.Sprintf("[... %d more entries in %s]\n", n.Omitted, fr.path(n.Path))
+		} else {
+			s = fmt.Sprintf("%s  [... %d more entries]\n", indent, n.Omitted)
+		}
+	case NoteChanged:
+		if fr.Minimal {
+			s = fr.MinimalHeader(n.Path) + changedMarker + "\n"
+		} else {
+			s = fmt.Sprintf("\nFILE: %s\n%s%s\n%s%s\n%s%s\n", fr.path(n.Path), indent, fr.delimiter(), indent, changedMarker, indent, fr.delimiter())
+		}
+	case NoteText:
+		s = n.Text
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// Record is a line of the jsonl format, describing a directory, a file or
+// a note.
+type Record struct {
+	Kind      string  `json:"kind"`
+	Path      string  `json:"path"`
+	Type      string  `json:"type,omitempty"`
+	Size      *int64  `json:"size,omitempty"`
+	Author    string  `json:"author,omitempty"`
+	Date      string  `json:"date,omitempty"`
+	Content   *string `json:"content,omitempty"`
+	Omitted   int     `json:"omitted,omitempty"`
+	Submodule bool    `json:"submodule,omitempty"`
+	Branch    string  `json:"branch,omitempty"`
+	Commit    string  `json:"commit,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	Dirty     bool    `json:"dirty,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	// InvalidUTF8 marks content whose invalid UTF-8 was replaced.
+	InvalidUTF8 bool `json:"invalid_utf8,omitempty"`
+	// Gitignored marks entries kept in spite of a .gitignore file.
+	Gitignored bool `json:"gitignored,omitempty"`
+	// Xattrs lists the extended attributes of a file.
+	Xattrs []Xattr `json:"xattrs,omitempty"`
+}
+
+// WriteRecord writes r to w as a line of JSON.
+func WriteRecord(w io.Writer, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// jsonlRenderer is the jsonl format: a Record per line for every directory,
+// file and note.
+type jsonlRenderer struct {
+	framing Framing
+}
+
+func (j *jsonlRenderer) Begin(w io.Writer) error { return nil }
+func (j *jsonlRenderer) End(w io.Writer) error   { return nil }
+
+func (j *jsonlRenderer) Dir(w io.Writer, dir Entry) error {
+	r := Record{Kind: "directory", Path: j.framing.path(dir.Path)}
+	if dir.Err != nil {
+		r.Error = "permission denied"
+	} else {
+		r.Size, r.Submodule, r.Gitignored = dir.Meta.Size, dir.Meta.Submodule, dir.Meta.Ignored
+	}
+	return WriteRecord(w, r)
+}
+
+func (j *jsonlRenderer) File(w io.Writer, f File) error {
+	size := f.Size
+	r := Record{
+		Kind:        "file",
+		Path:        j.framing.path(f.Path),
+		Type:        f.Type,
+		Size:        &size,
+		Author:      f.Meta.Author,
+		Date:        f.Meta.Date,
+		Gitignored:  f.Meta.Ignored,
+		Xattrs:      f.Meta.Xattrs,
+		InvalidUTF8: f.InvalidUTF8,
+	}
+	if f.IsText() && !f.HeaderOnly {
+		text := j.framing.text(f)
+		r.Content = &text
+	}
+	return WriteRecord(w, r)
+}
+
+func (j *jsonlRenderer) Note(w io.Writer, n Note) error {
+	switch n.Kind {
+	case NoteMore:
+		return WriteRecord(w, Record{Kind: "more", Path: j.framing.path(n.Path), Omitted: n.Omitted})
+	case NoteChanged:
+		return WriteRecord(w, Record{Kind: "file", Path: j.framing.path(n.Path), Error: "file changed during scan"})
+	case NoteText:
+		for _, r := range n.Records {
+			if err := WriteRecord(w, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package apptree
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// A ConcurrentRenderer is a Renderer that can split the rendering of a
+// large tree among goroutines, as the json and html renderers do.
+type ConcurrentRenderer interface {
+	Renderer
+	// RenderConcurrent writes what Render does, rendering subtrees of tree
+	// with up to n goroutines.
+	RenderConcurrent(w io.Writer, tree *Node, stats Stats, n int) error
+}
+
+// subtreeFormat is a format writing a directory as an opening, its
+// children with separators between them, and a closing, so that subtrees
+// can be rendered apart and joined in order. The tree is at depth 0, and
+// its opening and closing also start and end the document. Errors writing
+// to w are left to the caller, who writes to a bufio.Writer or a
+// bytes.Buffer.
+type subtreeFormat interface {
+	open(w io.Writer, dir *Node, depth int, stats Stats) error
+	sep(w io.Writer, depth int)
+	close(w io.Writer, dir *Node, depth int, stats Stats)
+	// node writes n and everything below it.
+	node(w io.Writer, n *Node, depth int) error
+}
+
+// subtreeRenderer is the ConcurrentRenderer of a subtreeFormat.
+type subtreeRenderer struct {
+	format subtreeFormat
+}
+
+func (r subtreeRenderer) Render(w io.Writer, tree *Node, stats Stats) error {
+	bw := bufio.NewWriter(w)
+	if err := r.format.open(bw, tree, 0, stats); err != nil {
+		return err
+	}
+	if err := r.nodes(bw, tree.Children, 1); err != nil {
+		return err
+	}
+	r.format.close(bw, tree, 0, stats)
+	return bw.Flush()
+}
+
+// nodes writes siblings at depth with the separators between them.
+func (r subtreeRenderer) nodes(w io.Writer, siblings []*Node, depth int) error {
+	for i, n := range siblings {
+		if i > 0 {
+			r.format.sep(w, depth)
+		}
+		if err := r.format.node(w, n, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	// subtreesPerWorker is about how many pieces each goroutine renders,
+	// so they finish at about the same time however the tree is shaped.
+	subtreesPerWorker = 8
+	// minSubtree is the fewest nodes worth handing to a goroutine.
+	minSubtree = 256
+)
+
+// piece is a part of the output of RenderConcurrent: text written in
+// advance, or siblings rendered by a worker into buf.
+type piece struct {
+	siblings []*Node
+	depth    int
+	buf      bytes.Buffer
+	err      error
+	// done is closed once buf holds the piece.
+	done chan struct{}
+}
+
+// RenderConcurrent splits the directories of tree holding more than a share
+// of its nodes into runs of siblings, which n goroutines render into
+// separate buffers while the buffers are written in order. Only so many
+// pieces are in flight at once, so the output is streamed rather than held
+// in memory.
+func (r subtreeRenderer) RenderConcurrent(w io.Writer, tree *Node, stats Stats, n int) error {
+	if n <= 1 {
+		return r.Render(w, tree, stats)
+	}
+	sizes := map[*Node]int{}
+	limit := max(countNodes(tree, sizes)/(n*subtreesPerWorker), minSubtree)
+
+	queue := make(chan *piece, 2*n)
+	work := make(chan *piece)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				p.err = r.nodes(&p.buf, p.siblings, p.depth)
+				close(p.done)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		defer close(work)
+		s := splitter{format: r.format, sizes: sizes, limit: limit, queue: queue, work: work, stop: stop}
+		s.dir(tree, 0, stats)
+		s.flush()
+	}()
+
+	bw := bufio.NewWriter(w)
+	var err error
+	for p := range queue {
+		<-p.done
+		if err = p.err; err != nil {
+			break
+		}
+		if _, err = bw.Write(p.buf.Bytes()); err != nil {
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// splitter cuts a tree into the pieces of RenderConcurrent.
+type splitter struct {
+	format subtreeFormat
+	sizes  map[*Node]int
+	limit  int
+	queue  chan<- *piece
+	work   chan<- *piece
+	stop   <-chan struct{}
+	// text is the text written in advance since the last piece.
+	text    *piece
+	stopped bool
+}
+
+// dir writes the opening of dir at depth, its children, split further when
+// they are large and otherwise gathered into runs of up to limit nodes,
+// and its closing.
+func (s *splitter) dir(dir *Node, depth int, stats Stats) {
+	if err := s.format.open(s.buf(), dir, depth, stats); err != nil {
+		s.text.err = err
+		s.flush()
+		s.stopped = true
+		return
+	}
+	var run []*Node
+	nodes := 0
+	for i, child := range dir.Children {
+		if s.stopped {
+			return
+		}
+		size := max(s.sizes[child], 1)
+		split := size > s.limit && len(child.Children) > 0
+		if len(run) > 0 && (split || nodes+size > s.limit) {
+			s.render(run, depth+1)
+			run, nodes = nil, 0
+		}
+		if len(run) > 0 {
+			// The worker writes the separators within a run.
+			run, nodes = append(run, child), nodes+size
+			continue
+		}
+		if i > 0 {
+			s.format.sep(s.buf(), depth+1)
+		}
+		if split {
+			s.dir(child, depth+1, stats)
+			continue
+		}
+		run, nodes = []*Node{child}, size
+	}
+	if len(run) > 0 {
+		s.render(run, depth+1)
+	}
+	if !s.stopped {
+		s.format.close(s.buf(), dir, depth, stats)
+	}
+}
+
+// buf returns the buffer of the text written in advance.
+func (s *splitter) buf() *bytes.Buffer {
+	if s.text == nil {
+		s.text = &piece{done: make(chan struct{})}
+		close(s.text.done)
+	}
+	return &s.text.buf
+}
+
+// flush queues the text written in advance.
+func (s *splitter) flush() {
+	if s.text != nil && !s.stopped {
+		s.send(s.queue, s.text)
+	}
+	s.text = nil
+}
+
+// render queues siblings at depth for a worker to render.
+func (s *splitter) render(siblings []*Node, depth int) {
+	s.flush()
+	p := &piece{siblings: siblings, depth: depth, done: make(chan struct{})}
+	if s.send(s.queue, p) {
+		s.send(s.work, p)
+	}
+}
+
+// send sends p on c unless RenderConcurrent stopped writing.
+func (s *splitter) send(c chan<- *piece, p *piece) bool {
+	select {
+	case c <- p:
+		return true
+	case <-s.stop:
+		s.stopped = true
+		return false
+	}
+}
+
+// countNodes returns the number of nodes from n down, recording it in sizes
+// for the directories.
+func countNodes(n *Node, sizes map[*Node]int) int {
+	count := 1
+	for _, child := range n.Children {
+		count += countNodes(child, sizes)
+	}
+	if n.Dir {
+		sizes[n] = count
+	}
+	return count
+}
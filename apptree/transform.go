@@ -0,0 +1,32 @@
+package apptree
+
+// Flatten returns a copy of the tree below root with the directories less
+// than depth levels below it dissolved, so the entries depth levels down
+// become direct children of root named by their path from it, such as
+// "services/api", and keep the structure below them. Files and empty or
+// unreadable directories above that depth are kept under their path name.
+// A depth of 1 or less returns root unchanged.
+func Flatten(root *Node, depth int) *Node {
+	if depth <= 1 || !root.Dir {
+		return root
+	}
+	flat := *root
+	flat.Children = nil
+	flattenInto(&flat.Children, root, "", 1, depth)
+	return &flat
+}
+
+// flattenInto appends the entries of dir, which is level levels below the
+// root, to out, naming them with prefix.
+func flattenInto(out *[]*Node, dir *Node, prefix string, level, depth int) {
+	for _, child := range dir.Children {
+		name := prefix + child.Name
+		if child.Dir && level < depth && len(child.Children) > 0 && child.Err == nil {
+			flattenInto(out, child, name+"/", level+1, depth)
+			continue
+		}
+		n := *child
+		n.Name = name
+		*out = append(*out, &n)
+	}
+}
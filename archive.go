@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	intoArchives bool
+	// maxArchiveEntrySize caps how much of an archive entry is read, so a
+	// zip bomb or a huge tar member can't exhaust memory.
+	maxArchiveEntrySize int64 = 64 << 20
+
+	archiveMu sync.Mutex
+	// openArchives holds the archives being walked by path, from which
+	// type and generated-code detection read the start of their entries.
+	openArchives = map[string]fs.FS{}
+)
+
+// errArchiveEntryTooLarge reports an archive entry over --max-archive-entry-size.
+var errArchiveEntryTooLarge = errors.New("archive entry exceeds --max-archive-entry-size")
+
+// archiveSeparator joins an archive path and the path of an entry inside it.
+const archiveSeparator = "!/"
+
+// isArchive reports whether path names an archive --into-archives can open.
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// traverseArchive writes the archive file as a directory holding the
+// archive's entries, named like archive.zip!/dir/file. The entries are
+// walked like a directory on disk, so they are ordered, filtered and
+// limited the same way.
+func traverseArchive(file apptree.Entry) {
+	path := file.Path
+	slog.Debug("Traversing archive", "path", path)
+
+	fsys, closeArchive, err := openArchive(path)
+	if err != nil {
+		contentWriter.WriteDir(apptree.Entry{Name: file.Name, Path: archiveEntryPath(path, "."), Depth: file.Depth})
+		slog.Error("Error reading archive", "path", path, "err", err)
+		stats.recordError(path, err)
+		return
+	}
+	defer closeArchive()
+	archiveMu.Lock()
+	openArchives[path] = fsys
+	archiveMu.Unlock()
+	defer func() {
+		archiveMu.Lock()
+		delete(openArchives, path)
+		archiveMu.Unlock()
+	}()
+
+	opts := rootOptions(".")
+	opts.FS, opts.PathPrefix, opts.Descend = fsys, archiveEntryPath(path, "."), nil
+	// --max-depth counts the levels outside the archive too, so
+	// selectEntry applies it.
+	opts.MaxDepth = 0
+	if err := apptree.Stream(analysisCtx, opts, &archiveTraversal{depth: file.Depth}); err != nil && !analysisStopped() {
+		slog.Error("Error reading archive", "path", path, "err", err)
+		stats.recordError(path, err)
+	}
+}
+
+// openArchive returns the entries of the archive at path as a file system,
+// and the function closing it.
+func openArchive(path string) (fs.FS, func() error, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r.Close, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	fsys, err := readTarFS(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fsys, func() error { return nil }, nil
+}
+
+// archiveEntryPath returns the path of the entry at name within archive.
+func archiveEntryPath(archive, name string) string {
+	if name == "." {
+		return archive + archiveSeparator
+	}
+	return archive + archiveSeparator + name
+}
+
+// archiveTraversal feeds the entries of an archive found depth levels
+// below its root to the content writer.
+type archiveTraversal struct {
+	depth int
+}
+
+func (t *archiveTraversal) Dir(dir apptree.Entry, entries []apptree.Entry) {
+	if dir.Err != nil {
+		slog.Error("Error reading archive entry", "path", dir.Path, "err", dir.Err)
+		stats.recordError(dir.Path, dir.Err)
+	}
+	// The entries are read in turn rather than ahead of time.
+	dir.Depth += t.depth
+	contentWriter.Dir(dir, nil)
+}
+
+func (t *archiveTraversal) File(file apptree.Entry) {
+	if file.Info == nil {
+		slog.Error("Error reading archive entry", "path", file.Path, "err", file.Err)
+		stats.recordError(file.Path, file.Err)
+		return
+	}
+	file.Depth += t.depth
+	contentWriter.File(file)
+}
+
+func (t *archiveTraversal) EndDir(dir apptree.Entry, omitted int) {
+	dir.Depth += t.depth
+	contentWriter.EndDir(dir, omitted)
+}
+
+// loadArchiveEntry reads the content of an archive entry.
+func loadArchiveEntry(file apptree.Entry) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readArchiveEntry(f, file.Info.Size())
+}
+
+// readArchiveEntry reads an archive entry of the given declared size,
+// failing with errArchiveEntryTooLarge rather than reading more than
+// --max-archive-entry-size, whatever the archive claims.
+func readArchiveEntry(r io.Reader, size int64) ([]byte, error) {
+	if size > maxArchiveEntrySize {
+		return nil, fmt.Errorf("%w: %d bytes", errArchiveEntryTooLarge, size)
+	}
+	content, err := io.ReadAll(io.LimitReader(r, maxArchiveEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxArchiveEntrySize {
+		return nil, fmt.Errorf("%w: more than %d bytes", errArchiveEntryTooLarge, maxArchiveEntrySize)
+	}
+	return content, nil
+}
+
+// readFSHeader returns up to headerSize bytes from the start of the file
+// at name within fsys.
+func readFSHeader(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// readHeader returns up to headerSize bytes from the start of the file at
+// path, which may name an entry of an archive being walked.
+func readHeader(path string) ([]byte, error) {
+	if archive, name, ok := strings.Cut(path, archiveSeparator); ok {
+		archiveMu.Lock()
+		fsys := openArchives[archive]
+		archiveMu.Unlock()
+		if fsys != nil {
+			// An unreadable entry is reported when its content is read.
+			header, _ := readFSHeader(fsys, name)
+			return header, nil
+		}
+	}
+
+	done := acquireFile()
+	defer done()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, explainOpenError(err)
+	}
+	defer f.Close()
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestIntoArchivesFilters checks that archive entries go through the same
+// filters as files on disk, and that oversized entries are skipped rather
+// than read.
+func TestIntoArchivesFilters(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(root, "bundle.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"src/main.go":          "package main\n",
+		"vendor/lib/lib.go":    "package lib\n",
+		"notes.txt":            "notes\n",
+		"assets/huge.txt":      strings.Repeat("xxx\n", 1024),
+		"src/api.pb.go":        "package api\n",
+		"src/other_ignored.md": "# ignored\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dir, printed := runApp(t, root, "--deterministic", "--no-precount", "--into-archives", "--exclude", "vendor",
+		"--exclude-name-regex", `\.md$`, "--skip-generated", "--max-archive-entry-size", "1024")
+	got := readOutput(t, dir, "app_tree_prompt.txt")
+
+	for _, want := range []string{"bundle.zip!/src/main.go", "bundle.zip!/notes.txt"} {
+		if !strings.Contains(got, "FILE: proj/"+want+"\n") {
+			t.Errorf("output lacks %s:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"lib.go", "huge.txt", "api.pb.go", "other_ignored.md"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("output holds %s:\n%s", unwanted, got)
+		}
+	}
+	if !strings.Contains(printed, "Skipping large archive entry") {
+		t.Errorf("the oversized entry wasn't reported:\n%s", printed)
+	}
+}
+
+// TestIntoArchivesTar checks that the entries of a gzipped tar are walked
+// as directories, like those of a directory on disk.
+func TestIntoArchivesTar(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(root, "bundle.tgz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, entry := range []struct{ name, content string }{
+		{"./src/main.go", "package main\n"},
+		{"./src/big.txt", strings.Repeat("big\n", 512)},
+		{"./README.md", "# bundle\n"},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, printed := runApp(t, root, "--deterministic", "--no-precount", "--into-archives", "--max-archive-entry-size", "1024")
+	got := readOutput(t, dir, "app_tree_prompt.txt")
+
+	for _, want := range []string{
+		"DIRECTORY: proj/bundle.tgz!/src\n",
+		"FILE: proj/bundle.tgz!/src/main.go\n",
+		"FILE: proj/bundle.tgz!/README.md\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "big.txt") {
+		t.Errorf("output holds the oversized entry:\n%s", got)
+	}
+	if !strings.Contains(printed, "Skipping large archive entry") {
+		t.Errorf("the oversized entry wasn't reported:\n%s", printed)
+	}
+}
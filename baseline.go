@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	baselinePath string
+	// baselinePaths holds the files that are new or differ from --baseline
+	// together with their ancestor directories, or nil without a baseline.
+	baselinePaths map[string]bool
+	// baselineAdded and baselineRemoved list the display paths of files
+	// missing from the baseline and from the tree, and baselineChanged
+	// counts the files whose content differs.
+	baselineAdded   []string
+	baselineRemoved []string
+	baselineChanged int
+)
+
+// loadBaseline reads a manifest written by --manifest-only, keyed by path.
+func loadBaseline(path string) (map[string]manifestRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := map[string]manifestRecord{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r manifestRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		records[r.Path] = r
+	}
+	return records, scanner.Err()
+}
+
+// selectBaselineChanges restricts the analysis of roots to the files that
+// were added or changed since the --baseline manifest, comparing content
+// hashes of files with the same path. The manifest must have been written
+// with the same roots and path options for the paths to match.
+func selectBaselineChanges(roots []string) error {
+	baseline, err := loadBaseline(baselinePath)
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, r := range collectManifest(roots) {
+		old, ok := baseline[r.Path]
+		delete(baseline, r.Path)
+		switch {
+		case !ok:
+			baselineAdded = append(baselineAdded, r.Path)
+		case old.Hash != r.Hash:
+			baselineChanged++
+		default:
+			continue
+		}
+		for _, root := range roots {
+			if strings.HasPrefix(r.file, root+string(filepath.Separator)) {
+				addWithAncestors(selected, root, r.file)
+				break
+			}
+		}
+	}
+	for path := range baseline {
+		baselineRemoved = append(baselineRemoved, path)
+	}
+	sort.Strings(baselineRemoved)
+	baselinePaths = selected
+	return nil
+}
+
+// writeBaselineHeader writes the comparison with --baseline: the number of
+// changed files and the files added and removed since.
+func writeBaselineHeader() {
+	var b strings.Builder
+	var records []jsonlRecord
+	fmt.Fprintf(&b, "BASELINE: %s\nCHANGED: %d files\n", baselinePath, baselineChanged)
+	fmt.Fprintf(&b, "ADDED: %d files\n", len(baselineAdded))
+	for _, path := range baselineAdded {
+		b.WriteString("  " + path + "\n")
+		records = append(records, jsonlRecord{Kind: "added", Path: path})
+	}
+	fmt.Fprintf(&b, "REMOVED: %d files\n", len(baselineRemoved))
+	for _, path := range baselineRemoved {
+		b.WriteString("  " + path + "\n")
+		records = append(records, jsonlRecord{Kind: "removed", Path: path})
+	}
+	b.WriteString(delimiter + "\n")
+	writeNote(apptree.Note{Kind: apptree.NoteText, Text: b.String(), Records: records})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchmarkSizes are the numbers of files in the benchmark trees.
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+var (
+	benchTrees    = map[int]string{}
+	benchTreeBase string
+)
+
+// benchTree returns the root of a tree of n files laid out like the
+// synthetic trees of the apptree benchmarks, creating it once per test
+// binary run: directories fan out ten ways, each holds up to twenty files,
+// and file sizes cycle from 0 to about 4 KB.
+func benchTree(b *testing.B, n int) string {
+	b.Helper()
+	if testing.Short() && n > 10000 {
+		b.Skip("skipping the largest tree in short mode")
+	}
+	if root, ok := benchTrees[n]; ok {
+		return root
+	}
+	if benchTreeBase == "" {
+		dir, err := os.MkdirTemp("", "app-tree-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchTreeBase = dir
+	}
+	root := filepath.Join(benchTreeBase, fmt.Sprintf("tree%d", n))
+	const filesPerDir, fanOut = 20, 10
+	for i := 0; i < n; i++ {
+		var parts []string
+		for d := i / filesPerDir; d > 0; d /= fanOut {
+			parts = append([]string{fmt.Sprintf("d%d", d%fanOut)}, parts...)
+		}
+		dir := filepath.Join(append([]string{root}, parts...)...)
+		if i%filesPerDir == 0 {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+		ext := []string{".go", ".md", ".json", ".txt"}[i%4]
+		content := strings.Repeat("x", (i*37)%4096)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%05d%s", i, ext)), []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	benchTrees[n] = root
+	return root
+}
+
+// BenchmarkContent measures the content path of the command end to end:
+// traverseDirectory and processFile streaming every file of the tree in
+// the text and jsonl formats, with --jobs 1 and 8. Each run is a fresh
+// process, as runApp starts, so the time includes its startup.
+func BenchmarkContent(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		for _, format := range []string{"text", "jsonl"} {
+			for _, jobs := range []int{1, 8} {
+				b.Run(fmt.Sprintf("files=%d/format=%s/jobs=%d", n, format, jobs), func(b *testing.B) {
+					root := benchTree(b, n)
+					outDir := b.TempDir()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						cmd := exec.Command(os.Args[0], root, "--format", format, "--jobs", fmt.Sprint(jobs), "--output-dir", outDir)
+						cmd.Env = append(os.Environ(), runMainEnv+"=1")
+						if out, err := cmd.CombinedOutput(); err != nil {
+							b.Fatalf("app-tree: %v\n%s", err, out)
+						}
+					}
+				})
+			}
+		}
+	}
+}
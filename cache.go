@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	useCache   bool
+	appendMode bool
+)
+
+// manifestSuffix is appended to the output file name to name the manifest.
+const manifestSuffix = ".manifest.json"
+
+// cacheEntry is the prepared content of a file as of its size and mtime.
+// Hash is the SHA-256 of the content as read, and Length its length.
+// Content is kept for text files only, since binary content isn't written.
+type cacheEntry struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Hash        string    `json:"hash,omitempty"`
+	Type        string    `json:"type"`
+	Length      int64     `json:"length"`
+	Content     string    `json:"content,omitempty"`
+	HeaderOnly  bool      `json:"header_only,omitempty"`
+	InvalidUTF8 bool      `json:"invalid_utf8,omitempty"`
+}
+
+// file returns the file of entry with the cached content.
+func (e cacheEntry) file(entry apptree.Entry) apptree.File {
+	content := []byte(e.Content)
+	return apptree.File{
+		Entry:       entry,
+		Type:        e.Type,
+		Size:        e.Length,
+		Raw:         content,
+		Content:     content,
+		HeaderOnly:  e.HeaderOnly,
+		InvalidUTF8: e.InvalidUTF8,
+	}
+}
+
+// cacheFile is the on-disk form of a cache. Key identifies the roots and
+// command line the entries were rendered with.
+type cacheFile struct {
+	Key     string                `json:"key"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// analysisCache stores prepared file content between runs so unchanged files
+// don't have to be read again. A nil cache is valid and never hits.
+type analysisCache struct {
+	path    string
+	key     string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	seen    map[string]cacheEntry
+}
+
+var cache *analysisCache
+
+// blockVersion changes whenever the preparation of file content does, so
+// entries cached by an older version are not reused.
+const blockVersion = "3"
+
+// cacheKey identifies a run by its roots and command line, since most flags
+// change the output, and by the rules of --rule-file, which the command
+// line only names.
+func cacheKey(root string, args []string) string {
+	s := blockVersion + "\x00" + root + "\x00" + strings.Join(args, "\x00")
+	if ruleSource != "" {
+		s += "\x00rules\x00" + ruleSource
+	}
+	key := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(key[:])
+}
+
+// openCache loads the cache for root under the OS cache directory.
+func openCache(root string, args []string) (*analysisCache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "app-tree")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	key := cacheKey(root, args)
+	return loadCache(filepath.Join(dir, key+".json"), key)
+}
+
+// openManifest loads the manifest --append keeps next to the output file,
+// recording the block and content hash of every file in that output.
+func openManifest(output, root string, args []string) (*analysisCache, error) {
+	return loadCache(output+manifestSuffix, cacheKey(root, args))
+}
+
+func loadCache(path, key string) (*analysisCache, error) {
+	c := &analysisCache{
+		path:    path,
+		key:     key,
+		entries: map[string]cacheEntry{},
+		seen:    map[string]cacheEntry{},
+	}
+
+	data, err := ioutil.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err == nil && f.Key == key && f.Entries != nil {
+		c.entries = f.Entries
+	}
+	// Otherwise the cache is corrupt or from another run and is rebuilt.
+	return c, nil
+}
+
+// lookup returns the cached entry for path if the file is unchanged.
+func (c *analysisCache) lookup(path string, info os.FileInfo) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return cacheEntry{}, false
+	}
+	c.seen[path] = entry
+	return entry, true
+}
+
+// lookupContent returns the cached entry for path if its content is
+// unchanged even though its size or mtime differ, as after a touch.
+func (c *analysisCache) lookupContent(path string, info os.FileInfo, content []byte) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.Hash == "" || entry.Hash != contentHash(content) {
+		return cacheEntry{}, false
+	}
+	entry.Size, entry.ModTime = info.Size(), info.ModTime()
+	c.seen[path] = entry
+	return entry, true
+}
+
+// store records the prepared content of f. Binary files embedded as data:
+// URIs are left out, as their content isn't kept.
+func (c *analysisCache) store(f apptree.File) {
+	if c == nil || !f.IsText() && embedAsDataURI(f.Size) {
+		return
+	}
+	entry := cacheEntry{
+		Size:        f.Info.Size(),
+		ModTime:     f.Info.ModTime(),
+		Hash:        contentHash(f.Raw),
+		Type:        f.Type,
+		Length:      f.Size,
+		HeaderOnly:  f.HeaderOnly,
+		InvalidUTF8: f.InvalidUTF8,
+	}
+	if f.IsText() {
+		entry.Content = string(f.Content)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[f.Path] = entry
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes the entries used by this run, dropping files that no longer
+// exist.
+func (c *analysisCache) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.Marshal(cacheFile{Key: c.key, Entries: c.seen})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, data, 0644)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipboardWarnSize is the output size above which copying to the clipboard
+// triggers a warning, as very large pastes tend to freeze chat UIs.
+const clipboardWarnSize = 1 << 20
+
+var copyToClipboard bool
+
+// copyOutputToClipboard copies the contents of the output file at path to the
+// system clipboard.
+func copyOutputToClipboard(path string) error {
+	if clipboard.Unsupported {
+		return fmt.Errorf("clipboard access is not available on this system")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(content) > clipboardWarnSize {
+		slog.Warn("Copying a very large output to the clipboard", "bytes", len(content))
+	}
+
+	if err := clipboard.WriteAll(string(content)); err != nil {
+		return fmt.Errorf("clipboard access is not available (is a display server running?): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// languageRule describes how to recognize a language and its comments.
+type languageRule struct {
+	name         string
+	extensions   []string
+	lineComments []string
+	blockStart   string
+	blockEnd     string
+}
+
+// languageRules is the table of languages --cloc recognizes. Add an entry to
+// support another language.
+var languageRules = []languageRule{
+	{name: "Go", extensions: []string{".go"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "JavaScript", extensions: []string{".js", ".jsx", ".mjs", ".cjs"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "TypeScript", extensions: []string{".ts", ".tsx"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "Python", extensions: []string{".py"}, lineComments: []string{"#"}},
+	{name: "Shell", extensions: []string{".sh", ".bash", ".zsh"}, lineComments: []string{"#"}},
+	{name: "Rust", extensions: []string{".rs"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "C", extensions: []string{".c", ".h"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "C++", extensions: []string{".cc", ".cpp", ".cxx", ".hpp"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "Java", extensions: []string{".java"}, lineComments: []string{"//"}, blockStart: "/*", blockEnd: "*/"},
+	{name: "Ruby", extensions: []string{".rb"}, lineComments: []string{"#"}},
+	{name: "YAML", extensions: []string{".yml", ".yaml"}, lineComments: []string{"#"}},
+	{name: "HTML", extensions: []string{".html", ".htm"}, blockStart: "<!--", blockEnd: "-->"},
+	{name: "CSS", extensions: []string{".css"}, blockStart: "/*", blockEnd: "*/"},
+}
+
+// lineCounts holds the cloc-style totals of a language.
+type lineCounts struct {
+	files   int
+	code    int
+	blank   int
+	comment int
+}
+
+var (
+	clocEnabled bool
+	clocMu      sync.Mutex
+	clocTotals  = map[string]*lineCounts{}
+)
+
+// languageFor returns the rule matching the extension of file.
+func languageFor(file string) (languageRule, bool) {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, rule := range languageRules {
+		for _, e := range rule.extensions {
+			if e == ext {
+				return rule, true
+			}
+		}
+	}
+	return languageRule{}, false
+}
+
+// recordCloc adds the line counts of file to the per-language totals.
+func recordCloc(file string, content []byte) {
+	rule, ok := languageFor(file)
+	if !ok {
+		return
+	}
+	counts := countLines(rule, content)
+
+	clocMu.Lock()
+	defer clocMu.Unlock()
+	total, ok := clocTotals[rule.name]
+	if !ok {
+		total = &lineCounts{}
+		clocTotals[rule.name] = total
+	}
+	total.files++
+	total.code += counts.code
+	total.blank += counts.blank
+	total.comment += counts.comment
+}
+
+// countLines classifies each line of content as code, blank or comment.
+func countLines(rule languageRule, content []byte) lineCounts {
+	var counts lineCounts
+	if len(content) == 0 {
+		return counts
+	}
+	content = bytes.TrimSuffix(content, []byte("\n"))
+
+	inBlock := false
+	forEachLine(content, func(raw []byte) {
+		line := strings.TrimSpace(string(raw))
+		switch {
+		case inBlock:
+			counts.comment++
+			if strings.Contains(line, rule.blockEnd) {
+				inBlock = false
+			}
+		case line == "":
+			counts.blank++
+		case rule.blockStart != "" && strings.HasPrefix(line, rule.blockStart):
+			counts.comment++
+			inBlock = !strings.Contains(line[len(rule.blockStart):], rule.blockEnd)
+		case hasAnyPrefix(line, rule.lineComments):
+			counts.comment++
+		default:
+			counts.code++
+		}
+	})
+	return counts
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// printCloc prints the per-language line counts, largest code count first.
+func printCloc() {
+	clocMu.Lock()
+	defer clocMu.Unlock()
+
+	languages := make([]string, 0, len(clocTotals))
+	for name := range clocTotals {
+		languages = append(languages, name)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if clocTotals[languages[i]].code != clocTotals[languages[j]].code {
+			return clocTotals[languages[i]].code > clocTotals[languages[j]].code
+		}
+		return languages[i] < languages[j]
+	})
+
+	var total lineCounts
+	fmt.Printf("\n%-12s %8s %8s %8s %8s\n", "Language", "Files", "Blank", "Comment", "Code")
+	for _, name := range languages {
+		c := clocTotals[name]
+		fmt.Printf("%-12s %8d %8d %8d %8d\n", name, c.files, c.blank, c.comment, c.code)
+		total.files += c.files
+		total.blank += c.blank
+		total.comment += c.comment
+		total.code += c.code
+	}
+	fmt.Printf("%-12s %8d %8d %8d %8d\n", "Total", total.files, total.blank, total.comment, total.code)
+}
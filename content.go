@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	normalize              bool
+	trimTrailingWhitespace bool
+	headLines              int
+	tailLines              int
+	maxContentBytes        int
+	stripANSI              bool
+	preserveEOFNewline     bool
+	wrapColumns            int
+)
+
+// ansiSequence matches ANSI CSI sequences such as colors and cursor
+// movement, and OSC sequences such as terminal titles and hyperlinks.
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// noEOFNewlineMarker follows content without a final newline under
+// --preserve-eof-newline, as in a unified diff.
+const noEOFNewlineMarker = `\ No newline at end of file`
+
+// longLineLength is the line length beyond which a file is reported as
+// having pathologically long lines, as minified or data files do.
+const longLineLength = 10000
+
+// truncateContent cuts content to at most --max-content-bytes bytes, backing
+// off to the start of a rune so that multibyte characters are never split.
+// It returns the number of bytes dropped.
+func truncateContent(content []byte) ([]byte, int) {
+	if maxContentBytes <= 0 || len(content) <= maxContentBytes {
+		return content, 0
+	}
+	n := maxContentBytes
+	for n > 0 && !utf8.RuneStart(content[n]) {
+		n--
+	}
+	return content[:n], len(content) - n
+}
+
+// toValidUTF8 returns text content as valid UTF-8 so it can't corrupt the
+// output. Content with a UTF-16 byte order mark is transcoded; otherwise
+// each run of invalid bytes becomes U+FFFD and replaced is set.
+func toValidUTF8(content []byte) (valid []byte, replaced bool) {
+	if utf8.Valid(content) {
+		return content, false
+	}
+	if len(content) >= 2 && len(content)%2 == 0 {
+		var order binary.ByteOrder
+		switch {
+		case content[0] == 0xfe && content[1] == 0xff:
+			order = binary.BigEndian
+		case content[0] == 0xff && content[1] == 0xfe:
+			order = binary.LittleEndian
+		}
+		if order != nil {
+			units := make([]uint16, 0, len(content)/2-1)
+			for i := 2; i < len(content); i += 2 {
+				units = append(units, order.Uint16(content[i:]))
+			}
+			return []byte(string(utf16.Decode(units))), false
+		}
+	}
+	return bytes.ToValidUTF8(content, []byte("\uFFFD")), true
+}
+
+// truncationMarker is the line appended to content cut by --max-content-bytes.
+func truncationMarker(dropped int) []byte {
+	return []byte(fmt.Sprintf("[... truncated %d bytes]", dropped))
+}
+
+// normalizeLine applies --strip-ansi and --normalize to a single line of
+// text content: escape sequences are removed, a trailing CR from a CRLF line
+// ending is dropped and, with --trim-trailing-whitespace, trailing spaces and
+// tabs are removed.
+func normalizeLine(line []byte) []byte {
+	if stripANSI {
+		line = ansiSequence.ReplaceAll(line, nil)
+	}
+	if !normalize && !trimTrailingWhitespace {
+		return line
+	}
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if trimTrailingWhitespace {
+		line = bytes.TrimRight(line, " \t")
+	}
+	return line
+}
+
+// forEachContentLine calls emit for every line of text content that is kept
+// by --head and --tail, with normalizeLine applied. Where lines are dropped,
+// elide is called once with the number of dropped lines instead. Content cut
+// by --max-content-bytes ends with a truncation marker line. With full set,
+// as for pinned files, every line is kept.
+func forEachContentLine(content []byte, full bool, emit func(line []byte), elide func(n int)) {
+	if full {
+		forEachLine(content, func(line []byte) { emit(normalizeLine(line)) })
+		return
+	}
+
+	content, dropped := truncateContent(content)
+	if dropped > 0 {
+		stats.recordTruncated()
+		defer emit(truncationMarker(dropped))
+	}
+
+	if headLines <= 0 && tailLines <= 0 {
+		forEachLine(content, func(line []byte) { emit(normalizeLine(line)) })
+		return
+	}
+
+	// A final newline doesn't start another line worth keeping, but the empty
+	// segment after it is still emitted so the framing stays the same.
+	body := content
+	trailingNewline := bytes.HasSuffix(body, []byte("\n"))
+	if trailingNewline {
+		body = body[:len(body)-1]
+	}
+
+	head, tail := max(headLines, 0), max(tailLines, 0)
+	total := bytes.Count(body, []byte("\n")) + 1
+	elided := total - head - tail
+
+	i := 0
+	forEachLine(body, func(line []byte) {
+		switch {
+		case elided <= 0 || i < head || i >= total-tail:
+			emit(normalizeLine(line))
+		case i == head:
+			elide(elided)
+		}
+		i++
+	})
+	if trailingNewline {
+		emit(nil)
+	}
+	if elided > 0 {
+		stats.recordElided(elided)
+	}
+}
+
+// forEachOutputLine is forEachContentLine for the text framings, which end
+// every emitted line with a newline. Lines longer than --wrap columns are
+// split over several. With --preserve-eof-newline the empty
+// line after a final newline is left out and content lacking one is
+// followed by noEOFNewlineMarker, so the source's final newline can be
+// reconstructed.
+func forEachOutputLine(content []byte, full bool, emit func(line []byte), elide func(n int)) {
+	if wrapColumns > 0 {
+		unwrapped := emit
+		emit = func(line []byte) { wrapLine(line, unwrapped) }
+	}
+	if !preserveEOFNewline {
+		forEachContentLine(content, full, emit, elide)
+		return
+	}
+
+	// Hold back each line until the next one arrives to find the last.
+	var last []byte
+	held := false
+	forEachContentLine(content, full, func(line []byte) {
+		if held {
+			emit(last)
+		}
+		last, held = line, true
+	}, func(n int) {
+		if held {
+			emit(last)
+			held = false
+		}
+		elide(n)
+	})
+	trailingNewline := bytes.HasSuffix(content, []byte("\n"))
+	if held && !(trailingNewline && len(last) == 0) {
+		emit(last)
+	}
+	if !trailingNewline {
+		emit([]byte(noEOFNewlineMarker))
+	}
+}
+
+// wrapLine calls emit with line cut into pieces of at most --wrap runes.
+func wrapLine(line []byte, emit func(line []byte)) {
+	for len(line) > wrapColumns {
+		i, n := 0, 0
+		for i < len(line) && n < wrapColumns {
+			_, size := utf8.DecodeRune(line[i:])
+			i += size
+			n++
+		}
+		if i == len(line) {
+			break
+		}
+		emit(line[:i])
+		line = line[i:]
+	}
+	emit(line)
+}
+
+// warnLongLines warns when text content has a line longer than
+// longLineLength bytes, which makes the output hard to read unwrapped.
+func warnLongLines(file string, content []byte) {
+	longest := 0
+	forEachLine(content, func(line []byte) { longest = max(longest, len(line)) })
+	if longest <= longLineLength {
+		return
+	}
+	if wrapColumns > 0 {
+		slog.Debug("File has very long lines", "path", file, "longest", longest)
+	} else {
+		slog.Warn("File has very long lines, consider --wrap", "path", file, "longest", longest)
+	}
+}
+
+// textContent returns text content as a string after normalization and
+// --head/--tail trimming, which full disables.
+func textContent(content []byte, full bool) string {
+	var b strings.Builder
+	first := true
+	next := func() {
+		if !first {
+			b.WriteByte('\n')
+		}
+		first = false
+	}
+	forEachContentLine(content, full, func(line []byte) {
+		next()
+		b.Write(line)
+	}, func(n int) {
+		next()
+		b.WriteString(apptree.ElisionMarker)
+	})
+	return b.String()
+}
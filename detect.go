@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/h2non/filetype"
+)
+
+// typeMapping overrides the detected type of files whose base name matches pattern.
+type typeMapping struct {
+	pattern  string
+	mimeType string
+}
+
+var (
+	typeMapFlags []string
+	typeMappings []typeMapping
+	binaryExts   []string
+	textExts     []string
+)
+
+// parseTypeMappings parses --type-map values of the form pattern=type.
+func parseTypeMappings(values []string) ([]typeMapping, error) {
+	var mappings []typeMapping
+	for _, value := range values {
+		pattern, mimeType, ok := strings.Cut(value, "=")
+		pattern, mimeType = strings.TrimSpace(pattern), strings.TrimSpace(mimeType)
+		if !ok || pattern == "" || mimeType == "" {
+			return nil, fmt.Errorf("invalid type mapping %q, expected pattern=type", value)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in type mapping %q: %v", value, err)
+		}
+		mappings = append(mappings, typeMapping{pattern: pattern, mimeType: mimeType})
+	}
+	return mappings, nil
+}
+
+// The methods resolveTypeMethod reports a type was detected by.
+const (
+	detectedByOverride  = "override"
+	detectedByExtension = "extension"
+	detectedByMagic     = "magic"
+	detectedByHeuristic = "heuristic"
+)
+
+// resolveType returns the type of file, preferring a --type-map override,
+// then a forced --text-ext/--binary-ext, over content detection.
+func resolveType(file string, content []byte) string {
+	fileType, _ := resolveTypeMethod(file, content)
+	return fileType
+}
+
+// resolveTypeMethod is resolveType, also returning how the type was
+// detected.
+func resolveTypeMethod(file string, content []byte) (fileType, method string) {
+	name := filepath.Base(file)
+	for _, m := range typeMappings {
+		if matched, _ := filepath.Match(m.pattern, name); matched {
+			return m.mimeType, detectedByOverride
+		}
+	}
+
+	ext := filepath.Ext(name)
+	if hasExt(textExts, ext) {
+		return "text/plain", detectedByExtension
+	}
+	if hasExt(binaryExts, ext) {
+		return "application/octet-stream", detectedByExtension
+	}
+
+	kind, _ := filetype.Match(content)
+	if kind != filetype.Unknown {
+		return kind.MIME.Value, detectedByMagic
+	}
+	if binaryUnderTextExt(file, content) {
+		// The content wins over the extension.
+		return "application/octet-stream", detectedByHeuristic
+	}
+	if len(content) > 0 && !looksBinary(content) {
+		return "text/plain", detectedByHeuristic
+	}
+	return "unknown", detectedByHeuristic
+}
+
+// looksBinary reports whether content appears to be binary data: its header
+// contains a NUL byte or isn't valid UTF-8.
+func looksBinary(content []byte) bool {
+	sample := content
+	if len(sample) > headerSize {
+		sample = sample[:headerSize]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	// The sample may end in the middle of a multi-byte rune.
+	for i := 0; i < utf8.UTFMax && i < len(sample); i++ {
+		if utf8.Valid(sample[:len(sample)-i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// textFormatExts are the extensions of formats that are always text, so
+// binary content under them means a corrupt or mislabeled file.
+var textFormatExts = map[string]bool{
+	".txt": true, ".md": true, ".rst": true, ".log": true, ".csv": true, ".tsv": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".cfg": true, ".conf": true,
+	".xml": true, ".html": true, ".htm": true, ".css": true, ".svg": true, ".sql": true,
+	".go": true, ".py": true, ".rb": true, ".rs": true, ".java": true, ".kt": true, ".c": true, ".h": true,
+	".cpp": true, ".hpp": true, ".cs": true, ".php": true, ".js": true, ".mjs": true, ".jsx": true,
+	".ts": true, ".tsx": true, ".sh": true, ".bash": true,
+}
+
+// binaryUnderTextExt reports whether file has the extension of a text
+// format while its header holds NUL bytes, which text never does. Files
+// whose type is forced by --type-map or --text-ext are left alone.
+func binaryUnderTextExt(file string, content []byte) bool {
+	name := filepath.Base(file)
+	ext := filepath.Ext(name)
+	if !textFormatExts[strings.ToLower(ext)] || hasExt(textExts, ext) {
+		return false
+	}
+	for _, m := range typeMappings {
+		if matched, _ := filepath.Match(m.pattern, name); matched {
+			return false
+		}
+	}
+	sample := content
+	if len(sample) > headerSize {
+		sample = sample[:headerSize]
+	}
+	return bytes.IndexByte(sample, 0) >= 0
+}
+
+// isText reports whether fileType denotes text content.
+func isText(fileType string) bool {
+	return strings.HasPrefix(fileType, "text")
+}
+
+// hasExt reports whether ext is in exts, ignoring case and a missing
+// leading dot in the list entries.
+func hasExt(exts []string, ext string) bool {
+	if ext == "" {
+		return false
+	}
+	for _, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerSize is the number of leading bytes read to detect a file's type
+// without loading the whole file.
+const headerSize = 8192
+
+// detectPathType resolves the type of the file at path from its header.
+func detectPathType(path string) string {
+	fileType, _ := detectPathTypeMethod(path)
+	return fileType
+}
+
+// detectPathTypeMethod is detectPathType, also returning how the type was
+// detected.
+func detectPathTypeMethod(path string) (fileType, method string) {
+	header, err := readHeader(path)
+	if err != nil {
+		slog.Error("Error reading file", "path", path, "err", err)
+		return "unknown", detectedByHeuristic
+	}
+	return resolveTypeMethod(path, header)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBinaryUnderTextExt(t *testing.T) {
+	binary := []byte("{\"name\": \x00\x01\x02}")
+	tests := []struct {
+		file    string
+		content []byte
+		want    bool
+	}{
+		{"config/app.json", binary, true},
+		{"README.MD", binary, true},
+		{"config/app.json", []byte("{\"name\": \"demo\"}\n"), false},
+		{"assets/data.bin", binary, false},
+		{"Makefile", binary, false},
+	}
+	for _, tt := range tests {
+		if got := binaryUnderTextExt(tt.file, tt.content); got != tt.want {
+			t.Errorf("binaryUnderTextExt(%q) is %v, want %v", tt.file, got, tt.want)
+		}
+		if tt.want {
+			if got, _ := resolveTypeMethod(tt.file, tt.content); isText(got) {
+				t.Errorf("%s resolved to %s, want a binary type", tt.file, got)
+			}
+		}
+	}
+}
+
+func TestBinaryUnderTextExtOverride(t *testing.T) {
+	defer func(mappings []typeMapping, exts []string) {
+		typeMappings, textExts = mappings, exts
+	}(typeMappings, textExts)
+
+	binary := []byte("a\x00b")
+	typeMappings = []typeMapping{{pattern: "*.json", mimeType: "text/plain"}}
+	if binaryUnderTextExt("app.json", binary) {
+		t.Error("a --type-map override was reported as a mismatch")
+	}
+	typeMappings, textExts = nil, []string{".log"}
+	if binaryUnderTextExt("app.log", binary) {
+		t.Error("a --text-ext extension was reported as a mismatch")
+	}
+}
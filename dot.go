@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formatDot writes the directory hierarchy as a Graphviz DOT graph.
+const formatDot = "dot"
+
+// dotSizes adds file sizes, and the total size of directories, to the node
+// labels of --format dot.
+var dotSizes bool
+
+// renderDot returns the recorded tree as a DOT graph with a node for every
+// file and directory and an edge from each directory to its entries.
+// Render it with, for example, dot -Tsvg app_tree.dot -o app_tree.svg.
+func renderDot() string {
+	var b strings.Builder
+	b.WriteString("digraph app_tree {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=note, fontname=\"Helvetica\", fontsize=10];\n")
+	n := 0
+	for _, root := range skeletonTree() {
+		writeDotNode(&b, root, &n)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDotNode writes node and the nodes below it, numbering them from *n,
+// and returns its ID and total size.
+func writeDotNode(b *strings.Builder, node *skeletonNode, n *int) (id string, size int64) {
+	id = fmt.Sprintf("n%d", *n)
+	*n++
+	var edges []string
+	size = node.size
+	for _, child := range node.children {
+		childID, childSize := writeDotNode(b, child, n)
+		edges = append(edges, childID)
+		size += childSize
+	}
+
+	label := node.name
+	if dotSizes {
+		label += fmt.Sprintf("\n%d bytes", size)
+	}
+	attrs := "label=" + strconv.Quote(label)
+	if node.dir {
+		attrs += ", shape=folder"
+	}
+	fmt.Fprintf(b, "  %s [%s];\n", id, attrs)
+	for _, child := range edges {
+		fmt.Fprintf(b, "  %s -> %s;\n", id, child)
+	}
+	return id, size
+}
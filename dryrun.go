@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+var dryRun bool
+
+// runDryRun walks roots applying the same filters as the analysis and prints
+// the files that would be processed, without reading their content.
+func runDryRun(roots []string) {
+	var files int
+	var totalSize int64
+
+	for _, root := range roots {
+		dryRunRoot(root, &files, &totalSize)
+	}
+
+	fmt.Printf("\nDry run: %d files would be processed, %d bytes in total.\n", files, totalSize)
+}
+
+func dryRunRoot(root string, files *int, totalSize *int64) {
+	walkRoot(root, func(path string, info os.FileInfo, err error) {
+		if err != nil {
+			slog.Error("Error accessing path", "path", path, "err", err)
+			return
+		}
+		if info.IsDir() {
+			return
+		}
+
+		rel := displayPath(path)
+		if relativeTo == "" {
+			if r, err := filepath.Rel(root, path); err == nil {
+				rel = r
+			}
+		}
+		fmt.Printf("%s (%d bytes)\n", rel, info.Size())
+		*files++
+		*totalSize += info.Size()
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	showDirSizes bool
+	// dirSizes holds the aggregated size of every visited directory, keyed by
+	// path, once computeDirSizes has run.
+	dirSizes map[string]int64
+)
+
+// computeDirSizes fills dirSizes for every directory under roots, visiting
+// the same entries as the traversal.
+func computeDirSizes(roots []string) {
+	dirSizes = map[string]int64{}
+	for _, root := range roots {
+		tree, _ := apptree.AnalyzeContext(analysisCtx, rootOptions(root))
+		if tree == nil {
+			continue
+		}
+		tree.Walk(func(n *apptree.Node) {
+			if n.Dir && n.Err == nil && !skipSubmodule(n.Path) {
+				dirSizes[n.Path] = n.Size
+			}
+		})
+	}
+}
+
+// dirSize returns the aggregated size of dir and whether --du computed it.
+func dirSize(dir string) (int64, bool) {
+	size, ok := dirSizes[dir]
+	return size, ok
+}
+
+// printLargestDirs lists the directories with the largest aggregated size.
+func printLargestDirs() {
+	if len(dirSizes) == 0 {
+		return
+	}
+	dirs := make([]string, 0, len(dirSizes))
+	for dir := range dirSizes {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirSizes[dirs[i]] != dirSizes[dirs[j]] {
+			return dirSizes[dirs[i]] > dirSizes[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	if len(dirs) > largestFilesCount {
+		dirs = dirs[:largestFilesCount]
+	}
+
+	fmt.Println("\nLargest directories:")
+	for _, dir := range dirs {
+		fmt.Printf("  %12d  %s\n", dirSizes[dir], displayPath(dir))
+	}
+}
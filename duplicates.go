@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var findDuplicates bool
+
+// runFindDuplicates walks roots applying the analysis filters and prints the
+// base names found in more than one directory, then the groups of files
+// with identical content.
+func runFindDuplicates(roots []string) {
+	var files []visitedEntry
+	for _, root := range roots {
+		walkRoot(root, func(path string, info os.FileInfo, err error) {
+			if err != nil {
+				slog.Error("Error accessing path", "path", path, "err", err)
+				return
+			}
+			if info.IsDir() {
+				return
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, visitedEntry{path: path, info: info})
+			}
+		})
+	}
+
+	names := duplicateNames(files)
+	contents := duplicateContents(files)
+
+	if len(names) > 0 {
+		fmt.Println("Duplicate names:")
+		for _, group := range names {
+			fmt.Printf("  %s\n", filepath.Base(group[0]))
+			for _, path := range group {
+				fmt.Printf("    %s\n", displayPath(path))
+			}
+		}
+	}
+	if len(contents) > 0 {
+		if len(names) > 0 {
+			fmt.Println()
+		}
+		fmt.Println("Duplicate content:")
+		for _, group := range contents {
+			fmt.Printf("  %d files of %d bytes\n", len(group), group[0].info.Size())
+			for _, f := range group {
+				fmt.Printf("    %s\n", displayPath(f.path))
+			}
+		}
+	}
+	if len(names) == 0 && len(contents) == 0 {
+		fmt.Println("No duplicates found.")
+	}
+}
+
+// duplicateNames groups the paths of files sharing a base name, sorted by
+// name.
+func duplicateNames(files []visitedEntry) [][]string {
+	byName := map[string][]string{}
+	for _, f := range files {
+		name := filepath.Base(f.path)
+		byName[name] = append(byName[name], f.path)
+	}
+
+	var groups [][]string
+	for _, paths := range byName {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			groups = append(groups, paths)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return filepath.Base(groups[i][0]) < filepath.Base(groups[j][0]) })
+	return groups
+}
+
+// duplicateContents groups files with identical content, largest first.
+// Only files sharing their size with another file are read and hashed.
+func duplicateContents(files []visitedEntry) [][]visitedEntry {
+	bySize := map[int64][]visitedEntry{}
+	for _, f := range files {
+		bySize[f.info.Size()] = append(bySize[f.info.Size()], f)
+	}
+
+	var groups [][]visitedEntry
+	for _, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byHash := map[string][]visitedEntry{}
+		for _, f := range candidates {
+			content, err := ioutil.ReadFile(f.path)
+			if err != nil {
+				slog.Error("Error reading file", "path", f.path, "err", err)
+				continue
+			}
+			hash := contentHash(content)
+			byHash[hash] = append(byHash[hash], f)
+		}
+		for _, group := range byHash {
+			if len(group) > 1 {
+				sort.Slice(group, func(i, j int) bool { return group[i].path < group[j].path })
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i][0].info.Size() != groups[j][0].info.Size() {
+			return groups[i][0].info.Size() > groups[j][0].info.Size()
+		}
+		return groups[i][0].path < groups[j][0].path
+	})
+	return groups
+}
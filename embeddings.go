@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// bytesPerToken approximates how many bytes of source text make up a token.
+const bytesPerToken = 4
+
+var chunkTokens int
+
+func init() {
+	apptree.RegisterStream(formatEmbeddings, func(apptree.Framing) apptree.StreamRenderer { return &embeddingsRenderer{} })
+}
+
+// embeddingChunk is one element of the --format embeddings array.
+type embeddingChunk struct {
+	Path     string            `json:"path"`
+	Content  string            `json:"content"`
+	Metadata embeddingMetadata `json:"metadata"`
+}
+
+type embeddingMetadata struct {
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	Chunk  int    `json:"chunk"`
+	Chunks int    `json:"chunks"`
+	Tokens int    `json:"tokens"`
+	Author string `json:"author,omitempty"`
+	Date   string `json:"date,omitempty"`
+}
+
+// estimateTokens returns an approximate token count for text.
+func estimateTokens(text string) int {
+	return (len(text) + bytesPerToken - 1) / bytesPerToken
+}
+
+// chunkText splits text into chunks of at most maxTokens estimated tokens,
+// breaking between lines where possible and otherwise on rune boundaries.
+func chunkText(text string, maxTokens int) []string {
+	if maxTokens <= 0 || estimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+	maxBytes := maxTokens * bytesPerToken
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if current.Len()+len(line) > maxBytes {
+			flush()
+		}
+		for len(line) > maxBytes {
+			n := maxBytes
+			for n > 0 && !utf8.RuneStart(line[n]) {
+				n--
+			}
+			chunks = append(chunks, line[:n])
+			line = line[n:]
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// embeddingsRenderer writes the text files as the elements of a JSON array,
+// split into chunks of --chunk-tokens. Only file content is embedded.
+type embeddingsRenderer struct {
+	// chunks counts the chunks written so far, so elements of the array can
+	// be separated.
+	chunks int
+}
+
+func (e *embeddingsRenderer) Begin(w io.Writer) error {
+	_, err := io.WriteString(w, "[")
+	return err
+}
+
+func (e *embeddingsRenderer) End(w io.Writer) error {
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func (e *embeddingsRenderer) Dir(w io.Writer, dir apptree.Entry) error { return nil }
+func (e *embeddingsRenderer) Note(w io.Writer, n apptree.Note) error   { return nil }
+
+// File writes the text content of f as one or more elements of the array.
+func (e *embeddingsRenderer) File(w io.Writer, f apptree.File) error {
+	if f.Size == 0 || !f.IsText() || f.HeaderOnly {
+		return nil
+	}
+	meta := embeddingMetadata{Type: f.Type, Size: f.Size, Author: f.Meta.Author, Date: f.Meta.Date}
+	chunks := chunkText(textContent(f.Content, isPinned(f.Path)), chunkTokens)
+	for i, chunk := range chunks {
+		meta.Chunk, meta.Chunks, meta.Tokens = i, len(chunks), estimateTokens(chunk)
+		data, err := json.Marshal(embeddingChunk{Path: displayPath(f.Path), Content: chunk, Metadata: meta})
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if e.chunks == 0 {
+			sep = "\n  "
+		}
+		e.chunks++
+		if _, err := io.WriteString(w, sep+string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
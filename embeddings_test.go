@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      []string
+	}{
+		{"unlimited", "a\nb\n", 0, []string{"a\nb\n"}},
+		{"fits", "short\n", 10, []string{"short\n"}},
+		{"between lines", "aaaa\nbbbb\ncccc\n", 3, []string{"aaaa\nbbbb\n", "cccc\n"}},
+		{"long line", strings.Repeat("x", 10), 1, []string{"xxxx", "xxxx", "xx"}},
+		{"runes", "ééé", 1, []string{"éé", "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkText(tt.text, tt.maxTokens)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunkText(%q, %d) = %q, want %q", tt.text, tt.maxTokens, got, tt.want)
+			}
+			for _, chunk := range got {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %q splits a rune", chunk)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"syscall"
+)
+
+var errorReportPath string
+
+// The categories of errors in the --error-report.
+const (
+	errorPermission = "permission"
+	errorNotFound   = "not-found"
+	errorTooLarge   = "too-large"
+	errorRead       = "read-error"
+	errorOpenFiles  = "too-many-open-files"
+)
+
+// traversalError is a path that failed during the traversal, as listed in
+// the --error-report.
+type traversalError struct {
+	Path     string `json:"path"`
+	Category string `json:"category"`
+	Error    string `json:"error"`
+}
+
+// errorCategory classifies err for the --error-report.
+func errorCategory(err error) string {
+	switch {
+	case errors.Is(err, errTooManyOpenFiles):
+		return errorOpenFiles
+	case errors.Is(err, fs.ErrPermission):
+		return errorPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return errorNotFound
+	case errors.Is(err, syscall.EFBIG), errors.Is(err, bytes.ErrTooLarge), errors.Is(err, bufio.ErrTooLong):
+		return errorTooLarge
+	default:
+		return errorRead
+	}
+}
+
+// writeErrorReport writes the errors recorded during the analysis to path as
+// JSON.
+func writeErrorReport(path string) error {
+	stats.mu.Lock()
+	report := struct {
+		Errors []traversalError `json:"errors"`
+	}{Errors: append([]traversalError{}, stats.failures...)}
+	stats.mu.Unlock()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// estimatedLineLength is the average line length assumed when estimating
+// the indentation and --head/--tail limits without reading whole files.
+const estimatedLineLength = 40
+
+var estimateOnly bool
+
+// runEstimate walks roots applying the analysis filters and prints the
+// approximate size of the output without generating it. Only the first
+// bytes of each file are read, to detect its type.
+func runEstimate(roots []string) {
+	var files int
+	var total int64
+	for _, root := range roots {
+		walkRoot(root, func(path string, info os.FileInfo, err error) {
+			if err != nil {
+				slog.Error("Error accessing path", "path", path, "err", err)
+				return
+			}
+
+			indent := strings.Repeat("  ", strings.Count(strings.TrimPrefix(path, root), string(filepath.Separator)))
+			if info.IsDir() {
+				if !sectionedPrompt() && !noHeader {
+					total += int64(len(fmt.Sprintf("\nDIRECTORY: %s\n%s%s\n", displayPath(path), indent, delimiter)))
+				}
+				return
+			}
+
+			files++
+			total += estimateFileBlock(path, info, indent)
+		})
+	}
+
+	fmt.Printf("Estimated output size: %d bytes (~%d tokens) for %d files.\n", total, (total+bytesPerToken-1)/bytesPerToken, files)
+}
+
+// estimateFileBlock returns the approximate size of the block written for a
+// file, taking the framing, content limits and omissions into account.
+func estimateFileBlock(path string, info os.FileInfo, indent string) int64 {
+	size := info.Size()
+	fileType := detectPathType(path)
+	if noBinary && size > 0 && !isText(fileType) && !isPinned(path) {
+		return 0
+	}
+
+	var framing int64
+	if noHeader {
+		framing = int64(len(minimalHeader(path)))
+	} else {
+		framing = int64(len(renderFileHeader(path, fileType, size))) + 2 + 2*int64(len(indent)+len(delimiter)+1)
+	}
+
+	var content int64
+	switch {
+	case size == 0:
+		content = int64(len(indent) + len("[empty file]\n"))
+	case headerOnlyByRule(path):
+		content = int64(len(indent) + len("[content omitted by rule]\n"))
+	case isText(fileType):
+		content = size
+		if !isPinned(path) {
+			if maxContentBytes > 0 && content > int64(maxContentBytes) {
+				content = int64(maxContentBytes)
+			}
+			if lines := headLines + tailLines; (headLines > 0 || tailLines > 0) && content > int64(lines*estimatedLineLength) {
+				content = int64(lines * estimatedLineLength)
+			}
+		}
+		lines := content/estimatedLineLength + 1
+		content += lines * int64(len(indent))
+	default:
+		content = int64(len(indent) + len("[Binary file content not displayed]\n"))
+	}
+	return framing + content
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	explainVisits bool
+
+	explainMu sync.Mutex
+	// explained holds the paths whose decision was already printed, as
+	// several passes apply the filters to the same entry.
+	explained = map[string]bool{}
+)
+
+// explainVisit prints to stderr whether the entry at path was included or
+// excluded and the rule that decided it, once per path.
+func explainVisit(path string, info os.FileInfo, visit bool, reason string) {
+	explainMu.Lock()
+	defer explainMu.Unlock()
+	if explained[path] {
+		return
+	}
+	explained[path] = true
+
+	name := displayPath(path)
+	if info.IsDir() {
+		name += "/"
+	}
+	decision := "excluded"
+	if visit {
+		decision = "included"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s %s\n", name, decision, reason)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	includeEmptyFiles bool
+	includeTypes      []string
+	excludeTypes      []string
+	pinPatterns       []string
+	nameRegex         string
+	excludeNameRegex  string
+)
+
+// selectEntry is the apptree Select hook of the analysis, applied after
+// --pin and --exclude, returning the reason worded to follow "excluded".
+//
+// Entries below --max-depth, and directories left out with --pick or
+// excluded by --smart, are left out. Otherwise the git selection,
+// --baseline, --sample, --fit-tokens, .gitignore and .promptignore files
+// apply. Entries inside archives were selected along with their archive
+// and skip the selections made for files on disk. The name and type
+// filters follow, then filterEntry.
+func selectEntry(path string, info os.FileInfo) (include bool, reason string) {
+	if beyondMaxDepth(path) {
+		return false, fmt.Sprintf("below --max-depth %d", maxDepth)
+	}
+	// Archive entries were selected along with their archive, so only the
+	// filters on the entry itself apply.
+	if !strings.Contains(path, archiveSeparator) {
+		if reason, selected := selectedPath(path, info); !selected {
+			return false, reason
+		}
+	}
+	if info.IsDir() {
+		if unpickedDirs[path] {
+			return false, "as not chosen with --pick"
+		}
+		if smartExcludeDirs[info.Name()] {
+			return false, "by --smart"
+		}
+	}
+	return true, ""
+}
+
+// filterEntry is the apptree Filter hook of the analysis, applying
+// --rule-file and then --skip-generated to the files passing the other
+// filters.
+func filterEntry(path string, info os.FileInfo) bool {
+	if info.IsDir() {
+		return true
+	}
+	return ruleActionFor(path, info) != ruleExclude && !isGenerated(path)
+}
+
+// explainDecision is the apptree Explain hook of the analysis under
+// --explain, wording the reason for the decision on the entry at path to
+// follow "included" or "excluded".
+func explainDecision(path string, info os.FileInfo, include bool, reason string) {
+	if include {
+		reason = inclusionReason(info, reason)
+	} else {
+		reason = exclusionReason(path, info, reason)
+	}
+	explainVisit(path, info, include, reason)
+}
+
+// inclusionReason words why an entry was included: by --pin, or else by
+// the first of --rule-file, --include-type, --name-regex and the git
+// selection to have selected it.
+func inclusionReason(info os.FileInfo, reason string) string {
+	switch {
+	case reason == apptree.ReasonPin:
+		return "by --pin"
+	case info.IsDir():
+	case fileRule != nil:
+		return "by --rule-file"
+	case reason == apptree.ReasonType:
+		return "by --include-type"
+	case reason == apptree.ReasonName:
+		return "by --name-regex"
+	case gitPaths != nil:
+		return "by --tracked-only, --git-status or --since-commit"
+	}
+	return "as no filter excludes it"
+}
+
+// exclusionReason words why an entry was left out by the filter reason
+// names, passing on the reasons of selectEntry.
+func exclusionReason(path string, info os.FileInfo, reason string) string {
+	switch reason {
+	case apptree.ReasonSkip:
+		return "as the output being written"
+	case apptree.ReasonExclude:
+		return "by --exclude"
+	case apptree.ReasonEmpty:
+		return "as empty by --include-empty-files=false"
+	case apptree.ReasonExcludeName:
+		return "by --exclude-name-regex"
+	case apptree.ReasonName:
+		return "as not matching --name-regex"
+	case apptree.ReasonType:
+		return "by --include-type or --exclude-type"
+	case apptree.ReasonFilter:
+		if ruleActionFor(path, info) == ruleExclude {
+			return "by --rule-file"
+		}
+		return "as generated by --skip-generated"
+	}
+	return reason
+}
+
+// selectedPath applies the selections made for files on disk: the git
+// selection, --baseline, --sample, --fit-tokens, .gitignore and
+// .promptignore. It returns the reason when path isn't selected.
+func selectedPath(path string, info os.FileInfo) (reason string, selected bool) {
+	switch {
+	case gitPaths != nil && !gitPaths[path]:
+		return "by --tracked-only, --git-status or --since-commit", false
+	case baselinePaths != nil && !baselinePaths[path]:
+		return "as unchanged since --baseline", false
+	case samplePaths != nil && !samplePaths[path]:
+		return "as not drawn by --sample", false
+	case fitPaths != nil && !fitPaths[path]:
+		return "to fit --fit-tokens", false
+	case !showIgnored && isGitignored(path, info.IsDir()):
+		return "by .gitignore", false
+	case isPromptignored(path, info.IsDir()):
+		return "by .promptignore", false
+	}
+	return "", true
+}
+
+// compileNameFilters compiles --name-regex and --exclude-name-regex into
+// opts.
+func compileNameFilters(opts *apptree.Options) error {
+	var err error
+	if nameRegex != "" {
+		if opts.Name, err = regexp.Compile(nameRegex); err != nil {
+			return fmt.Errorf("invalid --name-regex: %w", err)
+		}
+	}
+	if excludeNameRegex != "" {
+		if opts.ExcludeName, err = regexp.Compile(excludeNameRegex); err != nil {
+			return fmt.Errorf("invalid --exclude-name-regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// validatePins checks the patterns given to --pin.
+func validatePins() error {
+	for _, pattern := range pinPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --pin pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isPinned reports whether path matches a --pin glob, either by base name or
+// as a whole path. Pinned files bypass the filters and content limits.
+func isPinned(path string) bool {
+	return analysisOptions.Pinned(path)
+}
+
+// isOutputFile reports whether path is the file currently being written, its
+// --append manifest or its --resume checkpoint, so a streamed output never
+// ends up analyzing itself.
+func isOutputFile(path string) bool {
+	if outputPath == "" {
+		return false
+	}
+	switch path {
+	case outputPath, outputPath + manifestSuffix, outputPath + checkpointSuffix, outputPath + checkpointSuffix + ".tmp":
+		return true
+	}
+	return false
+}
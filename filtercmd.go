@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var filterCmd string
+
+// shellCommand returns a command running line through the platform shell.
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+// filterContent pipes content through --filter-cmd and returns its standard
+// output. The file's path and type are passed in APP_TREE_FILE and
+// APP_TREE_TYPE. If the command fails, content is returned unchanged.
+func filterContent(file, fileType string, content []byte) []byte {
+	cmd := shellCommand(filterCmd)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Env = append(os.Environ(), "APP_TREE_FILE="+file, "APP_TREE_TYPE="+fileType)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		slog.Warn("Filter command failed, using raw content", "path", file, "err", err, "stderr", strings.TrimSpace(stderr.String()))
+		return content
+	}
+	return out
+}
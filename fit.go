@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// omittedNote introduces the list of files left out by --fit-tokens.
+const omittedNote = "\n[Omitted %d files to fit %d tokens]\n"
+
+var (
+	fitTokens int
+	// fitPaths holds the files chosen by --fit-tokens together with their
+	// ancestor directories, or nil without a budget.
+	fitPaths map[string]bool
+	// fitOmitted lists the files left out to stay within the budget.
+	fitOmitted []string
+)
+
+// selectFitFiles chooses the files of roots that make up the output within
+// --fit-tokens. README files come first, then shallower files before deeper
+// ones; each is included if its estimated block, and the headers of any
+// directories it adds, still fit alongside the note listing the files left
+// out. Pinned files are always included.
+func selectFitFiles(roots []string) {
+	type candidate struct {
+		apptree.Entry
+		root  string
+		depth int
+	}
+	var candidates []candidate
+	for _, root := range roots {
+		var files []apptree.Entry
+		collectFiles(root, &files)
+		for _, f := range files {
+			depth := strings.Count(strings.TrimPrefix(f.Path, root), string(filepath.Separator))
+			candidates = append(candidates, candidate{f, root, depth})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := isReadme(candidates[i].Path), isReadme(candidates[j].Path)
+		if ri != rj {
+			return ri
+		}
+		if candidates[i].depth != candidates[j].depth {
+			return candidates[i].depth < candidates[j].depth
+		}
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	fitPaths = map[string]bool{}
+	used := int64(len(fmt.Sprintf(omittedNote, len(candidates), fitTokens)))
+	for _, c := range candidates {
+		used += omittedLine(c.Path)
+	}
+	budget := int64(fitTokens) * bytesPerToken
+	for _, c := range candidates {
+		indent := strings.Repeat("  ", c.depth)
+		cost := estimateFileBlock(c.Path, c.Info, indent)
+		var dirs []string
+		for dir := filepath.Dir(c.Path); !fitPaths[dir]; dir = filepath.Dir(dir) {
+			dirs = append(dirs, dir)
+			if !sectionedPrompt() && !noHeader {
+				cost += int64(len(fmt.Sprintf("\nDIRECTORY: %s\n%s%s\n", displayPath(dir), indent, delimiter)))
+			}
+			if dir == c.root || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+
+		// Every file starts out listed in the note; including it drops its line.
+		cost -= omittedLine(c.Path)
+		if used+cost > budget && !isPinned(c.Path) {
+			fitOmitted = append(fitOmitted, c.Path)
+			continue
+		}
+		used += cost
+		fitPaths[c.Path] = true
+		for _, dir := range dirs {
+			fitPaths[dir] = true
+		}
+	}
+	sort.Strings(fitOmitted)
+}
+
+// omittedLine returns the size of path's line in the note listing omitted
+// files.
+func omittedLine(path string) int64 {
+	return int64(len(displayPath(path))) + 3
+}
+
+// isReadme reports whether path is a README, which explains the rest of the
+// tree and so is included first.
+func isReadme(path string) bool {
+	return strings.HasPrefix(strings.ToLower(filepath.Base(path)), "readme")
+}
+
+// writeFitOmitted notes the files left out by --fit-tokens at the end of the
+// output.
+func writeFitOmitted() {
+	if len(fitOmitted) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, omittedNote, len(fitOmitted), fitTokens)
+	records := make([]jsonlRecord, len(fitOmitted))
+	for i, path := range fitOmitted {
+		b.WriteString("  " + displayPath(path) + "\n")
+		records[i] = jsonlRecord{Kind: "omitted", Path: displayPath(path)}
+	}
+	writeNote(apptree.Note{Kind: apptree.NoteText, Text: b.String(), Records: records})
+}
+
+// printFitSummary prints how the output compares to the --fit-tokens budget.
+func printFitSummary(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	tokens := (info.Size() + bytesPerToken - 1) / bytesPerToken
+	fmt.Printf("Output is about %d tokens of the %d budget; omitted %d files.\n", tokens, fitTokens, len(fitOmitted))
+}
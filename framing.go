@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	delimiter          string
+	fileHeaderTemplate string
+	noHeader           bool
+)
+
+// configureFraming maps --delimiter, --file-header-template, --no-header,
+// --path-style and --html-data-uri onto the framing of the streaming
+// formats. It runs once --format is final.
+func configureFraming() error {
+	header, err := apptree.ParseHeader(fileHeaderTemplate)
+	if err != nil {
+		return err
+	}
+	framing := apptree.Framing{
+		Delimiter: delimiter,
+		Header:    header,
+		Minimal:   noHeader,
+		// Directories are implied by the file paths, or already listed in
+		// the structure section.
+		OmitDirs: noHeader || sectionedPrompt(),
+		Path:     displayPath,
+		Lines:    outputLines,
+		Text: func(f apptree.File) string {
+			return textContent(f.Content, isPinned(f.Path))
+		},
+	}
+	if htmlDataURI {
+		framing.DataURISize = maxBinarySize
+	}
+	analysisOptions.Framing = framing
+	analysisOptions.Format = outputFormat
+	return nil
+}
+
+// outputLines is the Lines of the text framings: the lines
+// forEachOutputLine keeps, after warning about very long ones.
+func outputLines(f apptree.File, emit func(line []byte), elide func(n int)) {
+	warnLongLines(f.Path, f.Content)
+	forEachOutputLine(f.Content, isPinned(f.Path), emit, elide)
+}
+
+// describeEntry is the apptree Describe hook of the analysis, telling the
+// renderers what the flags show about an entry besides its content. Entries
+// without info are archives that couldn't be opened, shown as directories.
+func describeEntry(e apptree.Entry) apptree.Meta {
+	if e.Info != nil && !e.IsDir() {
+		return describeFile(e.Path)
+	}
+	var meta apptree.Meta
+	if size, ok := dirSize(e.Path); ok {
+		meta.Size = &size
+	}
+	meta.Submodule = isSubmodule(e.Path)
+	meta.Ignored = isGitignored(e.Path, true)
+	return meta
+}
+
+// describeFile returns what --show-ignored, --blame and --xattrs show
+// about file.
+func describeFile(file string) apptree.Meta {
+	meta := apptree.Meta{Ignored: isGitignored(file, false), Xattrs: fileXattrs(file)}
+	if blame {
+		meta.Author, meta.Date, _ = lastCommit(file)
+	}
+	return meta
+}
+
+// minimalHeader is the only framing written with --no-header.
+func minimalHeader(path string) string {
+	return analysisOptions.Framing.MinimalHeader(path)
+}
+
+// renderFileHeader returns the header lines of a file block, without the
+// delimiter that follows them.
+func renderFileHeader(file, fileType string, size int64) string {
+	f := apptree.File{Entry: apptree.Entry{Path: file, Meta: describeFile(file)}, Type: fileType, Size: size}
+	return analysisOptions.Framing.FileHeader(f)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+var (
+	skipGenerated bool
+	// generatedPatterns are base-name globs of files that are always
+	// considered generated.
+	generatedPatterns = []string{"*.min.js", "*.min.css", "*.pb.go", "*_pb2.py", "*.pb.cc", "*.pb.h", "*_generated.go", "*.generated.*"}
+	// generatedLineLength is the average line length above which a file is
+	// considered minified, or 0 to disable the check.
+	generatedLineLength int
+
+	generatedMu    sync.Mutex
+	generatedFiles = map[string]bool{}
+)
+
+// generatedMarker matches the header tools write into generated source, such
+// as "// Code generated by protoc-gen-go. DO NOT EDIT." or "# @generated".
+var generatedMarker = regexp.MustCompile(`(?m)^\W*(Code generated .*DO NOT EDIT|@generated\b)`)
+
+// validateGeneratedPatterns checks the globs given to --generated-pattern.
+func validateGeneratedPatterns() error {
+	for _, pattern := range generatedPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --generated-pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isGenerated reports whether --skip-generated leaves out the file at path.
+// The result is remembered so the counting pass and the traversal agree and
+// each file is counted once in the statistics.
+func isGenerated(path string) bool {
+	if !skipGenerated {
+		return false
+	}
+	generatedMu.Lock()
+	generated, ok := generatedFiles[path]
+	generatedMu.Unlock()
+	if ok {
+		return generated
+	}
+
+	generated = detectGenerated(path)
+	generatedMu.Lock()
+	generatedFiles[path] = generated
+	generatedMu.Unlock()
+	if generated {
+		stats.recordGenerated(path)
+	}
+	return generated
+}
+
+// detectGenerated applies the --skip-generated heuristics to the file at
+// path: its name, a generated-code marker near the top, and the average
+// line length of its header.
+func detectGenerated(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range generatedPatterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	header, err := readHeader(path)
+	n := len(header)
+	if err != nil || n == 0 || looksBinary(header) {
+		return false
+	}
+
+	if generatedMarker.Match(header) {
+		return true
+	}
+	if generatedLineLength > 0 {
+		lines := bytes.Count(header, []byte{'\n'})
+		if header[n-1] != '\n' {
+			lines++
+		}
+		return n/lines > generatedLineLength
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	blame           bool
+	gitContext      bool
+	gitStatusFilter []string
+	sinceCommit     string
+	fullContent     bool
+	trackedOnly     bool
+	// gitPaths holds the files selected by --git-status, --since-commit and
+	// --tracked-only together with their ancestor directories, or nil when
+	// none of them is used.
+	gitPaths map[string]bool
+)
+
+// runGit runs git with args in dir and returns its standard output.
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// gitTopLevel returns the root of the git repository containing dir.
+func gitTopLevel(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not inside a git repository: %w", dir, err)
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// loadGitStatus returns the absolute paths of files under dir whose git
+// status matches one of statuses (modified, untracked, staged), along with
+// their ancestor directories.
+func loadGitStatus(dir string, statuses []string) (map[string]bool, error) {
+	want := map[string]bool{}
+	for _, s := range statuses {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch s {
+		case "modified", "untracked", "staged":
+			want[s] = true
+		default:
+			return nil, fmt.Errorf("invalid git status %q, expected modified, untracked or staged", s)
+		}
+	}
+
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(dir, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		x, y, file := entry[0], entry[1], entry[3:]
+		if x == 'R' || x == 'C' {
+			// Renames and copies are followed by the original path.
+			i++
+		}
+
+		matched := false
+		switch {
+		case x == '?' && y == '?':
+			matched = want["untracked"]
+		default:
+			matched = (want["staged"] && x != ' ') || (want["modified"] && y != ' ')
+		}
+		if !matched {
+			continue
+		}
+
+		addWithAncestors(paths, top, filepath.Join(top, filepath.FromSlash(file)))
+	}
+	return paths, nil
+}
+
+// addWithAncestors adds path and its ancestors up to top to paths.
+func addWithAncestors(paths map[string]bool, top, path string) {
+	for p := path; !paths[p]; p = filepath.Dir(p) {
+		paths[p] = true
+		if p == top || p == filepath.Dir(p) {
+			break
+		}
+	}
+}
+
+// loadChangedSince returns the absolute paths of files under dir that differ
+// from ref in the working tree, along with their ancestor directories.
+func loadChangedSince(dir, ref string) (map[string]bool, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	// --end-of-options keeps a ref starting with "-" from being read as
+	// an option.
+	out, err := runGit(dir, "diff", "--name-only", "-z", "--end-of-options", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			addWithAncestors(paths, top, filepath.Join(top, filepath.FromSlash(file)))
+		}
+	}
+	return paths, nil
+}
+
+// loadTrackedFiles returns the absolute paths of the files git tracks in the
+// repository containing dir, including those of submodules, along with
+// their ancestor directories.
+func loadTrackedFiles(dir string) (map[string]bool, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(top, "ls-files", "-z", "--recurse-submodules")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			addWithAncestors(paths, top, filepath.Join(top, filepath.FromSlash(file)))
+		}
+	}
+	return paths, nil
+}
+
+// gitDiff returns the diff of file against ref.
+func gitDiff(file, ref string) ([]byte, error) {
+	return runGit(filepath.Dir(file), "diff", "--end-of-options", ref, "--", filepath.Base(file))
+}
+
+// selectGitPaths restricts the analysis of roots to the files selected by
+// --git-status, --since-commit and --tracked-only. When several are given,
+// files must match all of them.
+func selectGitPaths(roots []string) error {
+	if trackedOnly {
+		selected := map[string]bool{}
+		for _, root := range roots {
+			paths, err := loadTrackedFiles(root)
+			if err != nil {
+				return fmt.Errorf("--tracked-only: %w", err)
+			}
+			for path := range paths {
+				selected[path] = true
+			}
+		}
+		restrictGitPaths(selected)
+	}
+
+	if len(gitStatusFilter) > 0 {
+		selected := map[string]bool{}
+		for _, root := range roots {
+			paths, err := loadGitStatus(root, gitStatusFilter)
+			if err != nil {
+				return err
+			}
+			for path := range paths {
+				selected[path] = true
+			}
+		}
+		restrictGitPaths(selected)
+	}
+
+	if sinceCommit != "" {
+		selected := map[string]bool{}
+		for _, root := range roots {
+			paths, err := loadChangedSince(root, sinceCommit)
+			if err != nil {
+				return err
+			}
+			for path := range paths {
+				selected[path] = true
+			}
+		}
+		restrictGitPaths(selected)
+	}
+	return nil
+}
+
+// restrictGitPaths narrows gitPaths to the paths in selected.
+func restrictGitPaths(selected map[string]bool) {
+	if gitPaths == nil {
+		gitPaths = selected
+		return
+	}
+	for path := range gitPaths {
+		if !selected[path] {
+			delete(gitPaths, path)
+		}
+	}
+}
+
+// repoContext describes the revision of a repository the output was
+// generated from.
+type repoContext struct {
+	top     string
+	branch  string
+	commit  string
+	subject string
+	dirty   bool
+}
+
+// loadRepoContext returns the branch, latest commit and dirty state of the
+// repository containing dir.
+func loadRepoContext(dir string) (repoContext, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return repoContext{}, err
+	}
+	ctx := repoContext{top: top}
+
+	out, err := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return repoContext{}, err
+	}
+	ctx.branch = strings.TrimSpace(string(out))
+
+	out, err = runGit(dir, "log", "-1", "--format=%H%x00%s")
+	if err != nil {
+		return repoContext{}, err
+	}
+	ctx.commit, ctx.subject, _ = strings.Cut(strings.TrimSpace(string(out)), "\x00")
+
+	out, err = runGit(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return repoContext{}, err
+	}
+	ctx.dirty = len(bytes.TrimSpace(out)) > 0
+	return ctx, nil
+}
+
+// writeGitContext writes a header with the revision of every repository
+// containing one of roots. Roots outside a repository are skipped.
+func writeGitContext(roots []string) {
+	seen := map[string]bool{}
+	for _, root := range roots {
+		ctx, err := loadRepoContext(root)
+		if err != nil {
+			slog.Debug("Skipping git context", "path", root, "err", err)
+			continue
+		}
+		if seen[ctx.top] {
+			continue
+		}
+		seen[ctx.top] = true
+
+		state := "clean"
+		if ctx.dirty {
+			state = "dirty"
+		}
+		writeNote(apptree.Note{
+			Kind: apptree.NoteText,
+			Text: fmt.Sprintf("GIT REPOSITORY: %s\nBRANCH: %s\nCOMMIT: %s %s\nSTATE: %s\n%s\n",
+				displayPath(ctx.top), ctx.branch, ctx.commit, ctx.subject, state, delimiter),
+			Records: []jsonlRecord{{Kind: "git", Path: displayPath(ctx.top), Branch: ctx.branch, Commit: ctx.commit, Message: ctx.subject, Dirty: ctx.dirty}},
+		})
+	}
+}
+
+// lastCommit returns the author and date of the last commit touching file,
+// or ok=false when the file isn't tracked by git.
+func lastCommit(file string) (author, date string, ok bool) {
+	out, err := runGit(filepath.Dir(file), "log", "-1", "--format=%an%x00%ad", "--date=short", "--", filepath.Base(file))
+	if err != nil {
+		return "", "", false
+	}
+	author, date, ok = strings.Cut(strings.TrimSpace(string(out)), "\x00")
+	return author, date, ok
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestSinceCommitOptionRef checks that a --since-commit value starting with
+// "-" is treated as a ref, not passed to git as an option.
+func TestSinceCommitOptionRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "a.txt"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written := filepath.Join(t.TempDir(), "written")
+	ref := "--output=" + written
+	if _, err := loadChangedSince(dir, ref); err == nil {
+		t.Errorf("loadChangedSince accepted the ref %q", ref)
+	}
+	if _, err := gitDiff(filepath.Join(dir, "a.txt"), ref); err == nil {
+		t.Errorf("gitDiff accepted the ref %q", ref)
+	}
+	if _, err := os.Stat(written); err == nil {
+		t.Errorf("git took %q as an option and wrote %s", ref, written)
+	}
+
+	if _, err := loadChangedSince(dir, "HEAD"); err != nil {
+		t.Errorf("loadChangedSince(HEAD): %v", err)
+	}
+}
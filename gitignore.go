@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	useGitignore             bool
+	followGitignoreInParents bool
+	// showIgnored keeps gitignored entries in the output, marked as such.
+	showIgnored bool
+	// gitignoreBases maps each root to the highest directory whose
+	// .gitignore applies to it: the root itself, or with
+	// --follow-gitignore-in-parents the top of its repository.
+	gitignoreBases map[string]string
+
+	gitignoreMu    sync.Mutex
+	gitignoreRules = map[string][]gitignoreRule{}
+	gitignoredDirs = map[string]bool{}
+)
+
+// gitignoreRule is one pattern of a .gitignore file.
+type gitignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// anchored patterns contain a slash and match the path relative to the
+	// .gitignore's directory; others match the base name at any depth.
+	anchored bool
+}
+
+// loadGitignoreBases decides which .gitignore files apply to each root.
+// Roots outside a repository only use the files at or below them.
+func loadGitignoreBases(roots []string) {
+	if followGitignoreInParents || showIgnored {
+		useGitignore = true
+	}
+	if !useGitignore {
+		return
+	}
+	gitignoreBases = map[string]string{}
+	for _, root := range roots {
+		gitignoreBases[root] = root
+		if !followGitignoreInParents {
+			continue
+		}
+		if top, err := gitTopLevel(root); err == nil {
+			gitignoreBases[root] = top
+		}
+	}
+}
+
+// isGitignored reports whether path, or a directory it is in below its
+// root, is excluded by the .gitignore files that apply to it.
+func isGitignored(path string, isDir bool) bool {
+	root, base := gitignoreBase(path)
+	if base == "" || path == root {
+		return false
+	}
+	if matchesGitignore(path, base, isDir) {
+		return true
+	}
+	dir := filepath.Dir(path)
+	return dir != root && isGitignoredDir(dir, root, base)
+}
+
+// isGitignoredDir is isGitignored for directories, remembering the result
+// as every file below dir asks again.
+func isGitignoredDir(dir, root, base string) bool {
+	gitignoreMu.Lock()
+	ignored, ok := gitignoredDirs[dir]
+	gitignoreMu.Unlock()
+	if ok {
+		return ignored
+	}
+
+	ignored = matchesGitignore(dir, base, true)
+	if parent := filepath.Dir(dir); !ignored && parent != root && parent != dir {
+		ignored = isGitignoredDir(parent, root, base)
+	}
+	gitignoreMu.Lock()
+	gitignoredDirs[dir] = ignored
+	gitignoreMu.Unlock()
+	return ignored
+}
+
+// gitignoreBase returns the root containing path and the base of its
+// .gitignore files, or empty strings when .gitignore files aren't used.
+func gitignoreBase(path string) (root, base string) {
+	for r, b := range gitignoreBases {
+		if (path == r || strings.HasPrefix(path, r+string(filepath.Separator))) && len(r) > len(root) {
+			root, base = r, b
+		}
+	}
+	return root, base
+}
+
+// matchesGitignore reports whether path itself is excluded by a .gitignore
+// in its directory or one of its ancestors up to base. As in git, the last
+// matching rule wins and rules in deeper directories take precedence.
+func matchesGitignore(path, base string, isDir bool) bool {
+	return matchesIgnoreRules(path, base, isDir, loadGitignore)
+}
+
+// matchesIgnoreRules is matchesGitignore for the ignore files whose rules
+// load returns for a directory.
+func matchesIgnoreRules(path, base string, isDir bool, load func(dir string) []gitignoreRule) bool {
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == base || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range load(dirs[i]) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			subject := rel
+			if !rule.anchored {
+				subject = filepath.Base(path)
+			}
+			if rule.pattern.MatchString(subject) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// loadGitignore returns the rules of dir/.gitignore, reading it once.
+func loadGitignore(dir string) []gitignoreRule {
+	gitignoreMu.Lock()
+	defer gitignoreMu.Unlock()
+	if rules, ok := gitignoreRules[dir]; ok {
+		return rules
+	}
+
+	rules := readIgnoreFile(filepath.Join(dir, ".gitignore"), parseGitignoreLine)
+	gitignoreRules[dir] = rules
+	return rules
+}
+
+// readIgnoreFile returns the rules parse finds in the lines of the ignore
+// file at path, or none when it doesn't exist.
+func readIgnoreFile(path string, parse func(line string) (gitignoreRule, bool)) []gitignoreRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parse(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseGitignoreLine parses one line of a .gitignore file, returning
+// ok=false for blank lines and comments.
+func parseGitignoreLine(line string) (gitignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	var rule gitignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+
+	pattern, err := regexp.Compile("^" + gitignoreRegexp(line) + "$")
+	if err != nil {
+		return gitignoreRule{}, false
+	}
+	rule.pattern = pattern
+	return rule, true
+}
+
+// gitignoreRegexp translates a gitignore glob into a regular expression.
+func gitignoreRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(glob[i+1:], ']'); j >= 0 {
+				class := glob[i+1 : i+1+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += j + 1
+			} else {
+				b.WriteString(`\[`)
+			}
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// histogramWidth is the width of the longest bar of the text histogram.
+const histogramWidth = 40
+
+var sizeHistogram bool
+
+// sizeBuckets holds the upper bounds, exclusive, of the size histogram's
+// buckets; the last bucket takes everything larger.
+var sizeBuckets = []struct {
+	label string
+	max   int64
+}{
+	{"< 1 KB", 1 << 10},
+	{"1-10 KB", 10 << 10},
+	{"10-100 KB", 100 << 10},
+	{"100 KB-1 MB", 1 << 20},
+	{"1-10 MB", 10 << 20},
+	{">= 10 MB", -1},
+}
+
+// sizeBucket returns the index of the bucket holding files of size bytes.
+func sizeBucket(size int64) int {
+	for i, b := range sizeBuckets {
+		if b.max < 0 || size < b.max {
+			return i
+		}
+	}
+	return len(sizeBuckets) - 1
+}
+
+// sizeCounts returns the number of files counted in each size bucket.
+func (s *analysisStats) sizeCounts() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make([]int, len(sizeBuckets))
+	copy(counts, s.sizes)
+	return counts
+}
+
+// renderSizeHistogram returns the file size distribution as an ASCII bar
+// chart.
+func renderSizeHistogram(counts []int) string {
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	var b strings.Builder
+	b.WriteString("File sizes:\n")
+	for i, n := range counts {
+		bar := 0
+		if most > 0 {
+			bar = (n*histogramWidth + most - 1) / most
+		}
+		line := fmt.Sprintf("  %-12s %6d %s", sizeBuckets[i].label, n, strings.Repeat("#", bar))
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// renderSizeHistogramHTML returns the file size distribution as a chart
+// for the end of HTML output, or "" without --size-histogram.
+func renderSizeHistogramHTML() string {
+	if !sizeHistogram {
+		return ""
+	}
+	counts := stats.sizeCounts()
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+
+	var b strings.Builder
+	b.WriteString("    <style>\n")
+	b.WriteString("        #size-histogram table { border-collapse: collapse; font-size: 14px; }\n")
+	b.WriteString("        #size-histogram td { padding: 2px 6px; }\n")
+	b.WriteString("        #size-histogram .bar { height: 12px; min-width: 1px; background: #4a90d9; }\n")
+	b.WriteString("    </style>\n")
+	b.WriteString("    <figure id=\"size-histogram\">\n        <figcaption>File sizes</figcaption>\n        <table>\n")
+	for i, n := range counts {
+		width := 0
+		if most > 0 {
+			width = n * 300 / most
+		}
+		fmt.Fprintf(&b, "            <tr><td>%s</td><td><div class=\"bar\" style=\"width: %dpx;\"></div></td><td>%d</td></tr>\n",
+			template.HTMLEscapeString(sizeBuckets[i].label), width, n)
+	}
+	b.WriteString("        </table>\n    </figure>\n")
+	return b.String()
+}
+
+// writeSizeHistogram ends the output with the --size-histogram chart,
+// which HTML output shows at the end of the page.
+func writeSizeHistogram() {
+	if !sizeHistogram {
+		return
+	}
+	writeNote(apptree.Note{
+		Kind:   apptree.NoteText,
+		Text:   "\n" + renderSizeHistogram(stats.sizeCounts()),
+		Markup: renderSizeHistogramHTML(),
+	})
+}
+
+// printSizeHistogram prints the --size-histogram chart with the statistics.
+func printSizeHistogram() {
+	if sizeHistogram {
+		fmt.Print("\n" + renderSizeHistogram(stats.sizeCounts()))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSizeBucket(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "< 1 KB"},
+		{1023, "< 1 KB"},
+		{1024, "1-10 KB"},
+		{100<<10 - 1, "10-100 KB"},
+		{1 << 20, "1-10 MB"},
+		{1 << 40, ">= 10 MB"},
+	}
+	for _, tt := range tests {
+		if got := sizeBuckets[sizeBucket(tt.size)].label; got != tt.want {
+			t.Errorf("sizeBucket(%d) is %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestRenderSizeHistogram(t *testing.T) {
+	got := renderSizeHistogram([]int{8, 4, 1, 0, 0, 0})
+	want := `File sizes:
+  < 1 KB            8 ########################################
+  1-10 KB           4 ####################
+  10-100 KB         1 #####
+  100 KB-1 MB       0
+  1-10 MB           0
+  >= 10 MB          0
+`
+	if got != want {
+		t.Errorf("renderSizeHistogram wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+var (
+	htmlDataURI   bool
+	maxBinarySize int64
+)
+
+// embedAsDataURI reports whether a binary file of the given size is embedded
+// into the HTML output.
+func embedAsDataURI(size int64) bool {
+	return outputFormat == formatHTML && htmlDataURI && size > 0 && size <= maxBinarySize
+}
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/Cdaprod/app-tree/apptree"
+
+// jsonlRecord is a single line of --format jsonl output, describing a
+// directory, a file, entries left out by --limit-per-dir, or the repository
+// revision written by --git-context.
+type jsonlRecord = apptree.Record
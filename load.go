@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var jobs = 1
+
+// visitedEntry is a file or directory selected for the traversal.
+type visitedEntry struct {
+	path string
+	info os.FileInfo
+}
+
+// loadedFile is the content of a file read for processing. release must be
+// called once the content is no longer needed.
+type loadedFile struct {
+	content []byte
+	release func()
+	err     error
+}
+
+// loadEntry is the apptree Load hook of the analysis, reading archive
+// entries from their archive and files with loadFile.
+func loadEntry(file apptree.Entry) ([]byte, func(), error) {
+	if strings.Contains(file.Path, archiveSeparator) {
+		content, err := loadArchiveEntry(file)
+		return content, nil, err
+	}
+	l := loadFile(file.Path, file.Info)
+	return l.content, l.release, l.err
+}
+
+// loadFile reads the content to emit for file: its diff under
+// --since-commit, otherwise the file itself.
+func loadFile(file string, info os.FileInfo) loadedFile {
+	switch {
+	case sinceCommit != "" && !fullContent:
+		diff, err := gitDiff(file, sinceCommit)
+		if err != nil {
+			return loadedFile{release: func() {}, err: fmt.Errorf("reading diff: %w", err)}
+		}
+		return loadedFile{content: diff, release: func() {}}
+	case info.Size() > 0:
+		content, release, err := readFileContent(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return loadedFile{release: func() {}, err: fmt.Errorf("%w: %w", apptree.ErrChanged, err)}
+		}
+		if err != nil {
+			return loadedFile{release: func() {}, err: err}
+		}
+		// A symlink's own size is that of its target path, not the content.
+		if info.Mode().IsRegular() && int64(len(content)) != info.Size() {
+			release()
+			return loadedFile{release: func() {}, err: fmt.Errorf("%w: size changed from %d to %d bytes", apptree.ErrChanged, info.Size(), len(content))}
+		}
+		return loadedFile{content: content, release: release}
+	}
+	return loadedFile{release: func() {}}
+}
+
+// cachedEntry returns the cached content of file when it can be reused.
+func cachedEntry(file string, info os.FileInfo) (cacheEntry, bool) {
+	if clocEnabled || nearDupes || maxFilesPerType > 0 {
+		return cacheEntry{}, false
+	}
+	return cache.lookup(file, info)
+}
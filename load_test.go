@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// TestLoadFileChanged simulates files changing between listing their
+// directory and reading them.
+func TestLoadFileChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string) error
+	}{
+		{"deleted", os.Remove},
+		{"truncated", func(path string) error { return os.Truncate(path, 3) }},
+		{"grown", func(path string) error { return os.WriteFile(path, []byte("much longer content"), 0644) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "live.txt")
+			if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Lstat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(path); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := loadFile(path, info)
+			defer loaded.release()
+			if !errors.Is(loaded.err, apptree.ErrChanged) {
+				t.Errorf("loadFile returned %v, want apptree.ErrChanged", loaded.err)
+			}
+		})
+	}
+}
+
+func TestLoadFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "target.txt"), []byte("the target's content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := loadFile(link, info)
+	defer loaded.release()
+	if loaded.err != nil || string(loaded.content) != "the target's content" {
+		t.Errorf("loadFile = %q, %v, want the target's content", loaded.content, loaded.err)
+	}
+}
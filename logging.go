@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	logLevel  string
+	logFormat string
+)
+
+// setupLogger installs the default slog logger according to --log-level,
+// --log-format and the -d/--debug shorthand.
+func setupLogger() error {
+	var level slog.Level
+	switch strings.ToLower(logLevel) {
+	case "error":
+		level = slog.LevelError
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "info":
+		level = slog.LevelInfo
+	case "debug":
+		level = slog.LevelDebug
+	default:
+		return fmt.Errorf("invalid log level %q, expected error, warn, info or debug", logLevel)
+	}
+	if debug {
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", logFormat)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -1,42 +1,180 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"html/template"
+	"io/fs"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
-	"github.com/h2non/filetype"
-	"github.com/schollz/progressbar/v3"
+	"github.com/Cdaprod/app-tree/apptree"
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputMu sync.Mutex
-	output   strings.Builder
-	debug    bool
+	debug        bool
 	generateHTML bool
+	outputFormat string
+	serve        bool
+	useMmap      bool
+	lazyCount    bool
+	noPrecount   bool
+	noBinary     bool
+	limitPerDir  int
 )
 
 const (
-	outputFileName = "app_tree_prompt.txt"
-	htmlFileName   = "app_tree.html"
+	formatText  = "text"
+	formatHTML  = "html"
+	formatJSONL = "jsonl"
+	// formatEmbeddings writes a JSON array of file chunks for vector stores.
+	formatEmbeddings = "embeddings"
+	// formatSkeleton writes only the names and nesting of files and directories.
+	formatSkeleton = "skeleton"
+	// formatPDF lays out the text rendering as a PDF document.
+	formatPDF = "pdf"
 )
 
+// outputFileNames maps each output format to the name of the file it writes.
+var outputFileNames = map[string]string{
+	formatText:       "app_tree_prompt.txt",
+	formatHTML:       "app_tree.html",
+	formatJSONL:      "app_tree.jsonl",
+	formatEmbeddings: "app_tree_embeddings.json",
+	formatSkeleton:   "app_tree_skeleton.json",
+	formatPDF:        "app_tree.pdf",
+	formatTar:        "app_tree.tar",
+	formatDot:        "app_tree.dot",
+}
+
 func main() {
 	var rootCmd = &cobra.Command{
-		Use:   "app-tree [directory]",
+		Use:   "app-tree [directory...]",
 		Short: "Analyze and visualize directory structures",
 		Long:  `app-tree is a CLI tool that analyzes and displays the structure of directories in a tree-like format. It can generate either a text output or an HTML file for easy viewing.`,
-		Run:   runAnalysis,
+		Args:  cobra.ArbitraryArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogger()
+		},
+		Run: runAnalysis,
 	}
 
-	rootCmd.Flags().BoolVarP(&generateHTML, "html", "", false, "Generate a static HTML file instead of text output")
-	rootCmd.Flags().BoolVarP(&debug, "debug", "d", false, "Enable debug mode")
+	rootCmd.Flags().StringVarP(&outputFormat, "format", "f", formatText, "Output format: text, html, jsonl, embeddings, skeleton, dot, pdf or tar, or a tree format: json or markdown")
+	rootCmd.Flags().BoolVar(&dotSizes, "dot-sizes", false, "Label the nodes of --format dot with file and directory sizes")
+	rootCmd.Flags().BoolVar(&gzipOutput, "gzip", false, "Compress --format tar output as .tar.gz")
+	rootCmd.Flags().BoolVarP(&generateHTML, "html", "", false, "Generate a static HTML file instead of text output (shorthand for --format html)")
+	rootCmd.Flags().StringSliceVar(&typeMapFlags, "type-map", nil, "Override detected types with pattern=type pairs (e.g. Dockerfile=text/dockerfile,*.tsx=text/typescript)")
+	rootCmd.Flags().StringSliceVar(&textExts, "text-ext", nil, "Always treat files with these extensions as text (e.g. .env,.conf)")
+	rootCmd.Flags().StringSliceVar(&binaryExts, "binary-ext", nil, "Always treat files with these extensions as binary (e.g. .pdf,.docx)")
+	rootCmd.Flags().BoolVar(&stripANSI, "strip-ansi", false, "Remove ANSI escape sequences such as colors from text content")
+	rootCmd.Flags().IntVar(&headLines, "head", 0, "Show only the first N lines of each text file")
+	rootCmd.Flags().IntVar(&tailLines, "tail", 0, "Show only the last N lines of each text file")
+	rootCmd.Flags().StringVar(&filterCmd, "filter-cmd", "", "Pipe each text file's content through this shell command (APP_TREE_FILE and APP_TREE_TYPE are set)")
+	rootCmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 512, "With --format embeddings, split files into chunks of at most N tokens (0 to disable)")
+	rootCmd.Flags().IntVar(&maxContentBytes, "max-content-bytes", 0, "Truncate the content of each text file to N bytes")
+	rootCmd.Flags().BoolVar(&noBinary, "no-binary", false, "Omit binary files from the output entirely")
+	rootCmd.Flags().BoolVar(&htmlDataURI, "html-data-uri", false, "Embed small binary files in HTML output as data: URIs (images are shown inline)")
+	rootCmd.Flags().Int64Var(&maxBinarySize, "max-binary-size", 256*1024, "Maximum size in bytes of binary files embedded with --html-data-uri")
+	rootCmd.Flags().IntVar(&maxOpenFiles, "max-open-files", maxOpenFiles, "Keep at most N files open at once while reading concurrently")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Stop the analysis after this long (e.g. 30s, 5m) and keep the partial output (0 for no limit)")
+	rootCmd.Flags().IntVar(&jobs, "jobs", 1, "Read up to N files concurrently while writing them in order, and render json trees with N goroutines")
+	rootCmd.Flags().BoolVar(&useMmap, "mmap", false, "Memory-map files instead of reading them into memory")
+	rootCmd.Flags().StringSliceVar(&excludePatterns, "exclude", nil, "Skip files and directories whose base name matches these globs (e.g. vendor,*.min.js)")
+	rootCmd.Flags().IntVar(&flattenDepth, "flatten-depth", 0, "With --format json or markdown, list the entries N levels down by their path, like services/api, keeping the structure below them nested")
+	rootCmd.Flags().IntVar(&maxDepth, "max-depth", 0, "Descend at most N levels below each root (0 for no limit)")
+	rootCmd.Flags().StringVar(&nameRegex, "name-regex", "", "Only include files whose base name matches this regular expression")
+	rootCmd.Flags().StringVar(&excludeNameRegex, "exclude-name-regex", "", "Exclude files whose base name matches this regular expression (applied before --name-regex)")
+	rootCmd.Flags().BoolVar(&trackedOnly, "tracked-only", false, "Include only files tracked by git, leaving out build artifacts and ignored or untracked files")
+	rootCmd.Flags().BoolVar(&useGitignore, "gitignore", false, "Skip files and directories excluded by .gitignore files in the analyzed directories")
+	rootCmd.Flags().BoolVar(&followGitignoreInParents, "follow-gitignore-in-parents", false, "Also honor .gitignore files above the analyzed directory up to the repository root (implies --gitignore)")
+	rootCmd.Flags().BoolVar(&usePromptignore, "promptignore", true, "Skip files matched by .promptignore files, whose entries can end in \"# only:text,html\" to apply to some formats")
+	rootCmd.Flags().BoolVar(&showIgnored, "show-ignored", false, "Keep files excluded by .gitignore in the output, marked [gitignored] and dimmed in HTML (implies --gitignore)")
+	rootCmd.Flags().BoolVar(&traverseSubmodules, "submodules", true, "Traverse git submodules, which are marked [submodule]; use --submodules=false to list them without their contents")
+	rootCmd.Flags().BoolVar(&showDirSizes, "du", false, "Show the aggregated size of each directory")
+	rootCmd.Flags().BoolVar(&smartDefaults, "smart", false, "Detect the project type (Go, Node, Python, ...) and skip its build output and dependency directories")
+	rootCmd.Flags().StringSliceVar(&forcedProjectTypes, "project-type", nil, "Use the --smart defaults of these project types instead of detecting them (go, node, python, rust, java)")
+	rootCmd.Flags().BoolVar(&explainVisits, "explain", false, "Print to stderr why each entry was included or excluded, naming the flag or ignore file that decided it")
+	rootCmd.Flags().BoolVar(&pickDirs, "pick", false, "Interactively choose which top-level directories to include before the analysis")
+	rootCmd.Flags().BoolVar(&skipGenerated, "skip-generated", false, "Skip likely generated files: matching --generated-pattern, marked \"Code generated ... DO NOT EDIT\" or minified")
+	rootCmd.Flags().StringSliceVar(&generatedPatterns, "generated-pattern", generatedPatterns, "Base-name globs of files --skip-generated treats as generated")
+	rootCmd.Flags().IntVar(&generatedLineLength, "generated-line-length", 500, "Average line length above which --skip-generated treats a file as minified (0 disables)")
+	rootCmd.Flags().StringVar(&ruleFile, "rule-file", "", "CEL expression file deciding per file whether to include it, exclude it or keep only its header")
+	rootCmd.Flags().StringArrayVar(&pinPatterns, "pin", nil, "Always include files matching this glob in full, bypassing filters and content limits (repeatable)")
+	rootCmd.Flags().BoolVar(&includeEmptyFiles, "include-empty-files", true, "Include zero-byte files, marked as [empty file]")
+	rootCmd.Flags().BoolVar(&lazyCount, "lazy-count", false, "Start processing immediately with a spinner and count items in the background")
+	rootCmd.Flags().BoolVar(&noPrecount, "no-precount", false, "Skip counting items up front and show a spinner instead (implied when output is piped)")
+	rootCmd.Flags().StringSliceVar(&includeTypes, "include-type", nil, "Only include files whose MIME category matches (e.g. text,image)")
+	rootCmd.Flags().StringSliceVar(&excludeTypes, "exclude-type", nil, "Exclude files whose MIME category matches (e.g. image,video)")
+	rootCmd.Flags().StringSliceVar(&gitStatusFilter, "git-status", nil, "Only include files with these git statuses: modified, untracked, staged")
+	rootCmd.Flags().BoolVar(&sizeHistogram, "size-histogram", false, "Show how many files fall in each size range (<1 KB, 1-10 KB, ...) as a chart in the summary and at the end of text and HTML output")
+	rootCmd.Flags().BoolVar(&summaryOnly, "summary-only", false, "Print only the statistics summary without writing any output")
+	rootCmd.Flags().BoolVar(&nearDupes, "near-dupes", false, "Report clusters of highly similar text files using content fingerprints (compares every pair of files)")
+	rootCmd.Flags().BoolVar(&clocEnabled, "cloc", false, "Count code, blank and comment lines per language")
+	rootCmd.Flags().StringVar(&errorReportPath, "error-report", "", "Write a JSON report of every path that failed during the traversal, with its error and category")
+	rootCmd.Flags().StringVarP(&outputDirectory, "output-dir", "o", ".", "Directory to write output files to, or - to write the output to stdout")
+	rootCmd.Flags().BoolVar(&splitByDir, "split-by-dir", false, "Write a separate output for each top-level directory, named after it, instead of one combined file")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Checkpoint progress next to the output and continue an interrupted run with the same arguments instead of starting over")
+	rootCmd.Flags().BoolVar(&appendMode, "append", false, "Keep a manifest next to the output and only re-read files that are new or changed since the previous --append run")
+	rootCmd.Flags().BoolVar(&useCache, "cache", false, "Reuse output for files unchanged since the previous run with the same arguments")
+	rootCmd.Flags().StringVar(&sortKey, "sort", sortByName, "Order entries within each directory by name, size or mtime (largest and newest first)")
+	rootCmd.Flags().IntVar(&maxFilesPerType, "max-total-files-per-type", 0, "Include at most N files of each detected type and summarize the rest at the end")
+	rootCmd.Flags().IntVar(&sampleSize, "sample", 0, "Include a random sample of N files from across the tree instead of every file")
+	rootCmd.Flags().Int64Var(&sampleSeed, "seed", sampleSeed, "Seed for --sample, so the same tree gives the same sample")
+	rootCmd.Flags().IntVar(&fitTokens, "fit-tokens", 0, "Include files, READMEs and shallow files first, until the output would exceed N estimated tokens")
+	rootCmd.Flags().BoolVar(&rankFiles, "rank", false, "Output files ordered by relevance across all directories: entrypoints and READMEs, then configs, then tests, then other files (with --top, only the first N)")
+	rootCmd.Flags().StringArrayVar(&rankRuleFlags, "rank-rule", nil, "Rank files matching a glob ahead of the default --rank rules, as pattern=rank with lower ranks first (repeatable, e.g. 'cmd/*/main.go=0')")
+	rootCmd.Flags().IntVar(&topFiles, "top", 0, "Output only the N files ranked first by --sort across all directories")
+	rootCmd.Flags().BoolVar(&dirsFirst, "dirs-first", true, "List directories before files within each directory")
+	rootCmd.Flags().BoolVar(&filesFirst, "files-first", false, "List files before directories within each directory")
+	rootCmd.Flags().BoolVar(&intoArchives, "into-archives", false, "Analyze the contents of .zip, .tar and .tar.gz files as directories")
+	rootCmd.Flags().Int64Var(&maxArchiveEntrySize, "max-archive-entry-size", maxArchiveEntrySize, "Skip archive entries larger than N bytes with --into-archives")
+	rootCmd.Flags().IntVar(&limitPerDir, "limit-per-dir", 0, "Process at most N entries in each directory (0 for no limit)")
+	rootCmd.Flags().BoolVar(&gitContext, "git-context", false, "Start the output with the branch, latest commit and dirty state of each git repository")
+	rootCmd.Flags().StringVar(&sinceCommit, "since-commit", "", "Only include files changed since this git ref, showing their diff")
+	rootCmd.Flags().BoolVar(&fullContent, "full", false, "With --since-commit, show full file content instead of the diff")
+	rootCmd.Flags().BoolVar(&estimateOnly, "estimate", false, "Print the approximate output size without generating it")
+	rootCmd.Flags().BoolVar(&findDuplicates, "find-duplicates", false, "List files sharing a base name across directories and files with identical content, without writing output")
+	rootCmd.Flags().BoolVar(&mimeOnly, "mime-only", false, "Print each file's detected type and detection method (override, extension, magic, heuristic) without content")
+	rootCmd.Flags().BoolVar(&auditSecrets, "audit-secrets", false, "Report the files and lines holding likely secrets, without their values, instead of writing output")
+	rootCmd.Flags().BoolVar(&strict, "strict", false, "Exit with status 1 when --audit-secrets finds anything")
+	rootCmd.Flags().StringVar(&baselinePath, "baseline", "", "Only include files added or changed since this --manifest-only manifest, listing added and removed files in a header")
+	rootCmd.Flags().BoolVar(&manifestOnly, "manifest-only", false, "Print a sorted JSON line with the path, size, mtime and SHA-256 of each file without content")
+	rootCmd.Flags().BoolVar(&printConfig, "print-config", false, "Print the effective configuration as JSON: flag values, project types, excluded directories and ignore patterns")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the files that would be processed without reading them or writing output")
+	rootCmd.Flags().StringVar(&relativeTo, "relative-to", "", "Display paths relative to this base directory")
+	rootCmd.Flags().BoolVar(&deterministic, "deterministic", false, "Omit volatile data such as absolute paths so identical trees produce byte-identical output")
+	rootCmd.Flags().StringVar(&pathStyle, "path-style", pathStyleNative, "Separator style for emitted paths: native or unix")
+	rootCmd.Flags().IntVar(&wrapColumns, "wrap", 0, "Hard-wrap lines of text and HTML output longer than N columns")
+	rootCmd.Flags().BoolVar(&preserveEOFNewline, "preserve-eof-newline", false, "Match the source's final newline: drop the blank line otherwise shown after it and mark files without one")
+	rootCmd.Flags().BoolVar(&normalize, "normalize", false, "Convert CRLF line endings to LF in text content")
+	rootCmd.Flags().BoolVar(&trimTrailingWhitespace, "trim-trailing-whitespace", false, "Strip trailing whitespace from each line of text content (implies --normalize)")
+	rootCmd.Flags().StringVar(&delimiter, "delimiter", "==========================", "Separator line framing directory and file blocks")
+	rootCmd.Flags().BoolVar(&collapseChains, "collapse-chains", false, "Show chains of directories that each hold only the next as one entry, like src/main/java, in the structure section and skeleton")
+	rootCmd.Flags().StringVar(&promptStyle, "prompt-style", promptStyleRaw, "Layout of text output: raw, or sections with delimited system, structure and files parts")
+	rootCmd.Flags().StringVar(&contextFile, "context-file", "", "File whose content becomes the system section with --prompt-style sections")
+	rootCmd.Flags().BoolVar(&noHeader, "no-header", false, "Frame each file with just an === path === line followed by its raw content")
+	rootCmd.Flags().StringVar(&fileHeaderTemplate, "file-header-template", apptree.DefaultFileHeader, "Go template for file headers; fields: .Path, .Name, .Type, .Size, .Author, .Date, .Ignored, .Xattrs")
+	rootCmd.Flags().BoolVar(&showXattrs, "xattrs", false, "List the names and sizes of each file's extended attributes in its header (Linux and macOS)")
+	rootCmd.Flags().BoolVar(&blame, "blame", false, "Annotate each file with the author and date of its last git commit")
+	rootCmd.Flags().BoolVar(&copyToClipboard, "clipboard", false, "Also copy the generated output to the system clipboard")
+	rootCmd.Flags().BoolVar(&noTempFile, "no-temp-file", false, "With --serve, keep the output in memory instead of writing a temporary file")
+	rootCmd.Flags().BoolVar(&watchMode, "watch", false, "Serve the result and rebuild it when the tree changes, reloading the page in the browser (implies --serve)")
+	rootCmd.Flags().BoolVarP(&serve, "serve", "s", false, "Serve the result in the browser instead of writing it to the current directory")
+	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Enable debug mode (shorthand for --log-level debug)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level: error, warn, info or debug")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	rootCmd.PersistentFlags().StringVar(&serveHost, "host", serveHost, "Address for the web server to listen on (e.g. 0.0.0.0 to accept connections from other machines)")
+	rootCmd.PersistentFlags().IntVarP(&servePort, "port", "p", 8080, "Port for the web server")
+	rootCmd.PersistentFlags().BoolVar(&useTLS, "tls", false, "Serve over HTTPS, with a self-signed certificate unless --tls-cert and --tls-key are given")
+	rootCmd.PersistentFlags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file for serving over HTTPS")
+	rootCmd.PersistentFlags().StringVar(&tlsKey, "tls-key", "", "TLS key file for serving over HTTPS")
+	rootCmd.PersistentFlags().StringVar(&serveAuth, "auth", "", "Require HTTP basic auth credentials (user:pass) for the web server")
+
+	rootCmd.AddCommand(newServeCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -45,169 +183,624 @@ func main() {
 }
 
 func runAnalysis(cmd *cobra.Command, args []string) {
-	dir := "."
-	if len(args) > 0 {
-		dir = args[0]
+	roots, err := expandRoots(args)
+	if err != nil {
+		slog.Error("Error resolving directories", "err", err)
+		return
 	}
 
-	absDir, err := filepath.Abs(dir)
-	if err != nil {
-		log.Printf("Error getting absolute path: %v\n", err)
+	slog.Debug("Analyzing directories", "paths", roots)
+
+	if relativeTo != "" {
+		relativeTo, err = filepath.Abs(relativeTo)
+		if err != nil {
+			slog.Error("Error getting absolute path", "err", err)
+			return
+		}
+	}
+
+	if deterministic {
+		applyDeterministic(roots)
+	}
+
+	if err := configureAnalysis(roots); err != nil {
+		slog.Error("Error parsing analysis options", "err", err)
+		return
+	}
+	if ruleFile != "" {
+		if err := loadRuleFile(ruleFile, roots); err != nil {
+			slog.Error("Error loading rule file", "err", err)
+			return
+		}
+	}
+	if err := validatePromptStyle(); err != nil {
+		slog.Error("Error parsing prompt style", "err", err)
 		return
 	}
+	if err := validateGeneratedPatterns(); err != nil {
+		slog.Error("Error parsing generated patterns", "err", err)
+		return
+	}
+	if err := validatePathStyle(); err != nil {
+		slog.Error("Error parsing path style", "err", err)
+		return
+	}
+	if err := limitOpenFiles(); err != nil {
+		slog.Error("Error limiting open files", "err", err)
+		return
+	}
+	defer startTimeout()()
+
+	if generateHTML {
+		outputFormat = formatHTML
+	}
+	if watchMode {
+		serve = true
+	}
+	fileName, ok := outputFileNames[outputFormat]
+	if !ok {
+		fileName, ok = treeFormats[outputFormat]
+	}
+	if !ok {
+		slog.Error("Unknown output format", "format", outputFormat)
+		return
+	}
+	if outputFormat == formatTar {
+		tarRoots = roots
+		if gzipOutput {
+			fileName += ".gz"
+		}
+	}
+	if outputDirectory == stdoutPath {
+		if serve || splitByDir || resume || appendMode || copyToClipboard {
+			slog.Error("--output-dir - can't be combined with --serve, --watch, --split-by-dir, --resume, --append or --clipboard")
+			return
+		}
+		defer redirectMessagesToStderr()()
+		fileName = stdoutPath
+	}
 
-	if debug {
-		log.Printf("Analyzing directory: %s\n", absDir)
+	if err := configureFraming(); err != nil {
+		slog.Error("Error parsing file header template", "err", err)
+		return
 	}
 
-	tempDir, err := ioutil.TempDir("", "app-tree")
+	typeMappings, err = parseTypeMappings(typeMapFlags)
 	if err != nil {
-		log.Printf("Error creating temporary directory: %v\n", err)
+		slog.Error("Error parsing type mappings", "err", err)
 		return
 	}
-	defer os.RemoveAll(tempDir)
 
-	if debug {
-		log.Printf("Temporary directory created: %s\n", tempDir)
+	rankRules, err = parseRankRules(rankRuleFlags)
+	if err != nil {
+		slog.Error("Error parsing rank rules", "err", err)
+		return
 	}
 
-	fmt.Println("Counting items...")
-	totalItems := countItems(absDir)
-	fmt.Printf("Total items: %d\n", totalItems)
+	if err := selectGitPaths(roots); err != nil {
+		slog.Error("Error selecting files from git", "err", err)
+		return
+	}
 
-	fmt.Println("Processing files and directories...")
-	bar := progressbar.Default(int64(totalItems))
-	traverseDirectory(absDir, "", bar)
+	if smartDefaults || len(forcedProjectTypes) > 0 {
+		if err := applySmartDefaults(roots); err != nil {
+			slog.Error("Error applying project defaults", "err", err)
+			return
+		}
+	}
 
-	if debug {
-		log.Printf("Finished traversing directory\n")
+	if pickDirs {
+		if isTerminal(os.Stdin) {
+			if err := pickDirectories(roots, os.Stdin, os.Stdout); err != nil {
+				slog.Error("Error picking directories", "err", err)
+				return
+			}
+		} else {
+			slog.Warn("Ignoring --pick because stdin is not a terminal")
+		}
 	}
 
-	if generateHTML {
-		htmlContent := generateHTMLContent(output.String())
-		err = ioutil.WriteFile(htmlFileName, []byte(htmlContent), 0644)
+	loadSubmodules(roots)
+	loadGitignoreBases(roots)
+	loadPromptignoreRoots(roots)
+	// The configuration is complete here; what follows reads the files.
+	if printConfig {
+		if err := runPrintConfig(cmd.Flags(), roots); err != nil {
+			slog.Error("Error printing configuration", "err", err)
+		}
+		return
+	}
+	if baselinePath != "" {
+		if err := selectBaselineChanges(roots); err != nil {
+			slog.Error("Error comparing with baseline", "err", err)
+			return
+		}
+	}
+	if sampleSize > 0 {
+		selectSample(roots)
+	}
+	if fitTokens > 0 {
+		selectFitFiles(roots)
+	}
+
+	if dryRun {
+		runDryRun(roots)
+		return
+	}
+
+	if estimateOnly {
+		runEstimate(roots)
+		return
+	}
+
+	if mimeOnly {
+		runMimeOnly(roots)
+		return
+	}
+
+	if manifestOnly {
+		runManifestOnly(roots)
+		return
+	}
+
+	if auditSecrets {
+		if runAuditSecrets(roots) && strict {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if findDuplicates {
+		runFindDuplicates(roots)
+		return
+	}
+
+	if showDirSizes {
+		computeDirSizes(roots)
+	}
+
+	if summaryOnly {
+		runSummary(roots)
+		return
+	}
+
+	if noTempFile && (!serve || watchMode || resume || appendMode || copyToClipboard) {
+		slog.Warn("Ignoring --no-temp-file, which needs --serve without --watch, --resume, --append or --clipboard")
+		noTempFile = false
+	}
+
+	outputDir := outputDirectory
+	switch {
+	case fileName == stdoutPath:
+		outputDir = ""
+	case noTempFile:
+		// The output is kept in memory and never written to outputDir.
+	case serve:
+		tempDir, err := ioutil.TempDir("", "app-tree")
 		if err != nil {
-			log.Printf("Error writing to HTML file: %v\n", err)
+			slog.Error("Error creating temporary directory", "err", err)
 			return
 		}
-		fmt.Printf("\nAnalysis complete! Open %s in your web browser to view the results.\n", htmlFileName)
-	} else {
-		err = ioutil.WriteFile(outputFileName, []byte(output.String()), 0644)
+		defer os.RemoveAll(tempDir)
+		slog.Debug("Temporary directory created", "path", tempDir)
+		outputDir = tempDir
+	default:
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			slog.Error("Error creating output directory", "err", err)
+			return
+		}
+	}
+	if splitByDir && (serve || topFiles > 0 || rankFiles || resume || appendMode || copyToClipboard) {
+		slog.Warn("Ignoring --split-by-dir with --serve, --top, --rank, --resume, --append or --clipboard")
+		splitByDir = false
+	}
+	// Diffs depend on the repository rather than the file's mtime, so they
+	// are never cached.
+	switch {
+	case sinceCommit != "":
+	case appendMode && !serve:
+		cache, err = openManifest(filepath.Join(outputDir, fileName), strings.Join(roots, "\x00"), os.Args[1:])
+		if err != nil {
+			slog.Warn("Manifest unavailable", "err", err)
+		}
+	case useCache:
+		cache, err = openCache(strings.Join(roots, "\x00"), os.Args[1:])
 		if err != nil {
-			log.Printf("Error writing to file: %v\n", err)
+			slog.Warn("Cache unavailable", "err", err)
+		}
+	}
+
+	if resume {
+		switch {
+		case serve || topFiles > 0 || rankFiles:
+			slog.Warn("Ignoring --resume with --serve, --top or --rank")
+		case outputFormat != formatText && outputFormat != formatHTML && outputFormat != formatJSONL:
+			slog.Warn("Ignoring --resume, which only supports the text, html and jsonl formats")
+		default:
+			checkpoint, err = openCheckpoint(filepath.Join(outputDir, fileName), strings.Join(roots, "\x00"), os.Args[1:])
+			if err != nil {
+				slog.Error("Error reading checkpoint", "err", err)
+				return
+			}
+			if checkpoint.resuming() {
+				fmt.Printf("Resuming after %d entries written by an interrupted run.\n", len(checkpoint.done))
+			}
+			saveCheckpointOnInterrupt()
+		}
+	}
+
+	if isTreeFormat() && (splitByDir || topFiles > 0 || rankFiles) {
+		slog.Warn("Ignoring --split-by-dir, --top and --rank, which don't apply to tree formats", "format", outputFormat)
+		splitByDir, topFiles, rankFiles = false, 0, false
+	}
+
+	var units []outputUnit
+	switch {
+	case isTreeFormat():
+		units = []outputUnit{{path: filepath.Join(outputDir, fileName), roots: roots, write: func() {
+			renderTrees(roots)
+		}}}
+	case splitByDir:
+		units = splitOutputUnits(roots, outputDir, filepath.Ext(fileName))
+	case rankFiles:
+		units = []outputUnit{{path: filepath.Join(outputDir, fileName), roots: roots, write: func() {
+			renderRankedFiles(roots)
+			writeFitOmitted()
+			writeSampleNote()
+			if maxFilesPerType > 0 {
+				writeTypeCapSummary()
+			}
+			writeSizeHistogram()
+			writePartialNote()
+		}}}
+	case topFiles > 0:
+		units = []outputUnit{{path: filepath.Join(outputDir, fileName), roots: roots, write: func() {
+			renderTopFiles(roots)
+			writeSizeHistogram()
+			writePartialNote()
+		}}}
+	default:
+		units = []outputUnit{{path: filepath.Join(outputDir, fileName), roots: roots, write: func() {
+			bar := newAnalysisProgress(roots)
+			for _, root := range roots {
+				traverseDirectory(root, bar)
+			}
+			writeFitOmitted()
+			writeSampleNote()
+			if maxFilesPerType > 0 {
+				writeTypeCapSummary()
+			}
+			writeSizeHistogram()
+			writePartialNote()
+			bar.Finish()
+		}}}
+	}
+	for _, unit := range units {
+		if err := writeOutputUnit(unit); err != nil {
+			slog.Error("Error writing output", "path", unit.path, "err", err)
 			return
 		}
+		slog.Debug("Output written", "path", outputPath)
+	}
+	checkpoint.remove()
 
-		if debug {
-			log.Printf("Output written to: %s\n", outputFileName)
+	if errorReportPath != "" {
+		if err := writeErrorReport(errorReportPath); err != nil {
+			slog.Error("Error writing error report", "err", err)
 		}
+	}
 
-		fmt.Printf("\nAnalysis complete! Output written to: %s\n", outputFileName)
+	if err := cache.save(); err != nil {
+		slog.Warn("Error saving cache", "err", err)
 	}
-}
 
-func countItems(dir string) int {
-	count := 0
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error accessing path %s: %v\n", path, err)
-			return nil
+	if copyToClipboard {
+		if err := copyOutputToClipboard(outputPath); err != nil {
+			slog.Error("Error copying output to clipboard", "err", err)
+		} else {
+			fmt.Println("Output copied to clipboard.")
 		}
-		count++
-		return nil
-	})
-	return count
+	}
+
+	if serve {
+		if watchMode {
+			reloads = &liveReload{clients: map[chan struct{}]bool{}}
+			go watchAndRebuild(roots, outputPath)
+		}
+		serveOutput(outputPath)
+		return
+	}
+
+	if splitByDir {
+		fmt.Printf("\nAnalysis complete! Wrote %d files to: %s\n", len(units), outputDir)
+	} else if fileName == stdoutPath {
+		fmt.Println("\nAnalysis complete! Output written to stdout.")
+	} else if outputFormat == formatHTML {
+		fmt.Printf("\nAnalysis complete! Open %s in your web browser to view the results.\n", filepath.Join(outputDir, fileName))
+	} else {
+		fmt.Printf("\nAnalysis complete! Output written to: %s\n", filepath.Join(outputDir, fileName))
+	}
+	stats.printSummary()
+	printSizeHistogram()
+	if analysisStopped() {
+		fmt.Printf("Stopped after --timeout %s; the output is partial.\n", timeout)
+	}
+	if fitTokens > 0 && !splitByDir {
+		printFitSummary(outputPath)
+	}
+	if sampleSkipped() > 0 {
+		fmt.Printf("Sampled %d of %d files with seed %d; skipped %d.\n", sampleSize, sampleTotal, sampleSeed, sampleSkipped())
+	}
+	if clocEnabled {
+		printCloc()
+	}
+	if nearDupes {
+		printNearDuplicates()
+	}
 }
 
-func traverseDirectory(dir, indent string, bar *progressbar.ProgressBar) {
-	if debug {
-		log.Printf("Traversing directory: %s\n", dir)
+// newAnalysisProgress returns the progress display for traversing roots,
+// counting the items up front unless a spinner was asked for.
+func newAnalysisProgress(roots []string) *progress {
+	switch {
+	case noPrecount || !isTerminal(os.Stdout):
+		fmt.Println("Processing files and directories...")
+		return newProgress(-1)
+	case lazyCount:
+		fmt.Println("Processing files and directories...")
+		bar := newProgress(-1)
+		go func() {
+			totalItems := countRoots(roots)
+			slog.Debug("Counted items", "total", totalItems)
+			bar.SetTotal(int64(totalItems))
+		}()
+		return bar
+	default:
+		fmt.Println("Counting items...")
+		totalItems := countRoots(roots)
+		fmt.Printf("Total items: %d\n", totalItems)
+
+		fmt.Println("Processing files and directories...")
+		return newProgress(int64(totalItems))
 	}
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	entries, err := os.ReadDir(dir)
+func serveOutput(path string) {
+	fmt.Println("\nAnalysis complete!")
+	stats.printSummary()
+	var err error
+	if noTempFile {
+		err = serveContent(filepath.Base(path), servedOutput.Bytes())
+	} else {
+		err = serveResult(path)
+	}
 	if err != nil {
-		log.Printf("Error reading directory %s: %v\n", dir, err)
+		slog.Error("Error serving results", "err", err)
+	}
+}
+
+// countItems returns the number of items the traversal of dir will report as
+// progress, applying the same ordering, filters and limits.
+func countItems(dir string) int {
+	n, err := apptree.Count(analysisCtx, rootOptions(dir))
+	if err != nil && !analysisStopped() {
+		slog.Error("Error reading directory", "path", dir, "err", err)
+	}
+	return n
+}
+
+// traverseDirectory writes the blocks of dir and everything below it that
+// the analysis includes.
+func traverseDirectory(dir string, bar *progress) {
+	slog.Debug("Traversing directory", "path", dir)
+	if err := apptree.Stream(analysisCtx, rootOptions(dir), &traversal{bar: bar}); err != nil && !analysisStopped() {
+		slog.Error("Error reading directory", "path", dir, "err", err)
+		stats.recordError(dir, err)
+	}
+}
+
+// traversal feeds the entries apptree.Stream visits to the content writer,
+// keeping the statistics, the checkpoint and the progress display, and
+// opening archives with --into-archives.
+type traversal struct {
+	bar *progress
+}
+
+func (t *traversal) Dir(dir apptree.Entry, entries []apptree.Entry) {
+	path := dir.Path
+	switch {
+	case errors.Is(dir.Err, fs.ErrPermission):
+		slog.Warn("Permission denied reading directory", "path", path)
+		stats.recordPermissionDenied(path)
+		stats.recordError(path, dir.Err)
+	case dir.Err != nil:
+		slog.Error("Error reading directory", "path", path, "err", dir.Err)
+		stats.recordError(path, dir.Err)
+	default:
+		stats.recordDir(path)
+	}
+	contentWriter.Dir(dir, readAhead(entries))
+}
+
+func (t *traversal) File(file apptree.Entry) {
+	path, info := file.Path, file.Info
+	if info == nil {
+		slog.Error("Error accessing path", "path", path, "err", file.Err)
+		stats.recordError(path, file.Err)
 		return
 	}
+	switch {
+	case checkpoint.wasDone(path):
+	case intoArchives && isArchive(path):
+		traverseArchive(file)
+		checkpoint.markDone(path)
+	default:
+		processFile(file)
+		checkpoint.markDone(path)
+	}
+	t.bar.AddBytes(info.Size())
+	t.bar.Add(1)
+	slog.Debug("Processed", "path", path)
+}
 
-	writeOutput(fmt.Sprintf("\nDIRECTORY: %s\n%s==========================\n", dir, indent))
+func (t *traversal) EndDir(dir apptree.Entry, omitted int) {
+	contentWriter.EndDir(dir, omitted)
+	if dir.Depth > 0 {
+		t.bar.Add(1)
+		slog.Debug("Processed", "path", dir.Path)
+	}
+}
 
-	for _, entry := range entries {
-		path := filepath.Join(dir, entry.Name())
-		if entry.IsDir() {
-			traverseDirectory(path, indent+"  ", bar)
-		} else {
-			processFile(path, indent+"  ")
+// readAhead returns the files among entries that the content writer may
+// read ahead of time with --jobs, leaving out those written by an
+// interrupted run, reused from the cache or opened as archives.
+func readAhead(entries []apptree.Entry) []apptree.Entry {
+	if jobs <= 1 {
+		return nil
+	}
+	var files []apptree.Entry
+	for _, e := range entries {
+		if e.Info == nil || e.IsDir() || intoArchives && isArchive(e.Path) || checkpoint.wasDone(e.Path) {
+			continue
 		}
-		bar.Add(1)
-		if debug {
-			log.Printf("Processed: %s\n", path)
+		if _, ok := cachedEntry(e.Path, e.Info); !ok {
+			files = append(files, e)
 		}
 	}
+	return files
 }
 
-func processFile(file, indent string) {
-	if debug {
-		log.Printf("Processing file: %s\n", file)
-	}
+// processFile writes the block of file, reusing the cached one when the
+// file is unchanged.
+func processFile(file apptree.Entry) {
+	slog.Debug("Processing file", "path", file.Path)
 
-	content, err := ioutil.ReadFile(file)
-	if err != nil {
-		log.Printf("Error reading file %s: %v\n", file, err)
+	if entry, ok := cachedEntry(file.Path, file.Info); ok {
+		stats.recordFile(file.Path, entry.Type, file.Info.Size())
+		contentWriter.WriteFile(entry.file(file))
+		slog.Debug("Using cached output", "path", file.Path)
 		return
 	}
+	contentWriter.File(file)
+
+	slog.Debug("Finished processing file", "path", file.Path)
+}
+
+// prepareFile is the apptree Prepare hook of the analysis. It leaves out
+// the files --no-binary and --max-total-files-per-type omit, keeps the
+// statistics, and turns the content read into the content written:
+// notebooks as text, the output of --filter-cmd and valid UTF-8. Content
+// unchanged since it was cached is taken from the cache instead.
+func prepareFile(f *apptree.File) bool {
+	file, content := f.Path, f.Raw
+	// Archive entries are never cached.
+	cacheable := !strings.Contains(file, archiveSeparator)
+	if cacheable && !clocEnabled && !nearDupes && maxFilesPerType <= 0 {
+		if entry, ok := cache.lookupContent(file, f.Info, content); ok {
+			stats.recordFile(file, entry.Type, f.Info.Size())
+			*f = entry.file(f.Entry)
+			slog.Debug("Using cached output for unchanged content", "path", file)
+			return true
+		}
+	}
+
+	size, fileType := f.Size, f.Type
+	if binaryUnderTextExt(file, content) {
+		slog.Warn("Binary content under a text extension, treating it as binary", "path", file)
+		stats.recordTypeMismatch(file)
+	}
+	if noBinary && size > 0 && !isText(fileType) && !isPinned(file) {
+		stats.recordOmittedBinary()
+		slog.Debug("Omitted binary file", "path", file)
+		return false
+	}
+	if maxFilesPerType > 0 && !isPinned(file) && overTypeCap(fileType) {
+		slog.Debug("Omitted file over the per-type limit", "path", file, "type", fileType)
+		return false
+	}
+	stats.recordFile(file, fileType, size)
+	if clocEnabled {
+		recordCloc(file, content)
+	}
+	if nearDupes && isText(fileType) {
+		recordFingerprint(file, content)
+	}
+	f.HeaderOnly = headerOnlyByRule(file)
+	if outputFormat == formatTar {
+		// The archive holds files exactly as they are on disk.
+		return true
+	}
+	if isNotebook(file) && isText(fileType) && !f.HeaderOnly {
+		if text, err := notebookText(content); err == nil {
+			f.Content = text
+		} else {
+			slog.Debug("Showing notebook as JSON", "path", file, "err", err)
+		}
+	}
+	if filterCmd != "" && size > 0 && isText(fileType) && !f.HeaderOnly {
+		f.Content = filterContent(file, fileType, f.Content)
+	}
+	if isText(fileType) && !f.HeaderOnly {
+		if f.Content, f.InvalidUTF8 = toValidUTF8(f.Content); f.InvalidUTF8 {
+			stats.recordInvalidUTF8()
+		}
+	}
+	if cacheable {
+		cache.store(*f)
+	}
+	return true
+}
 
-	kind, _ := filetype.Match(content)
-	fileTypeStr := "unknown"
-	if kind != filetype.Unknown {
-		fileTypeStr = kind.MIME.Value
+// reportReadError is the apptree OnError hook of the analysis, reporting
+// the files and archive entries that couldn't be read.
+func reportReadError(path string, err error) {
+	switch {
+	case errors.Is(err, apptree.ErrChanged):
+		slog.Warn("File changed during scan", "path", path, "err", err)
+		stats.recordChanged(path)
+	case errors.Is(err, errArchiveEntryTooLarge):
+		slog.Warn("Skipping large archive entry", "path", path, "err", err)
+	case strings.Contains(path, archiveSeparator):
+		slog.Error("Error reading archive entry", "path", path, "err", err)
+	default:
+		slog.Error("Error reading file", "path", path, "err", err)
 	}
+	stats.recordError(path, err)
+}
 
-	output := fmt.Sprintf("\nFILE: %s\nTYPE: %s\nSIZE: %d bytes\nCONTENT:\n%s==========================\n", file, fileTypeStr, len(content), indent)
+// readFileContent reads file, memory-mapping it when --mmap is set and
+// falling back to a regular read where mapping isn't possible.
+func readFileContent(file string) ([]byte, func(), error) {
+	done := acquireFile()
+	defer done()
+	if useMmap {
+		content, release, err := mmapFile(file)
+		if err == nil {
+			return content, release, nil
+		}
+		slog.Debug("Falling back to regular read", "path", file, "err", err)
+	}
 
-	if strings.HasPrefix(fileTypeStr, "text") {
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			output += indent + template.HTMLEscapeString(line) + "\n"
+	content, err := ioutil.ReadFile(file)
+	return content, func() {}, explainOpenError(err)
+}
+
+// forEachLine calls fn for every newline-separated line of content without
+// copying it, matching the segments strings.Split would produce.
+func forEachLine(content []byte, fn func(line []byte)) {
+	for {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			fn(content)
+			return
 		}
-	} else {
-		output += indent + "[Binary file content not displayed]\n"
-	}
-
-	output += indent + "==========================\n"
-	writeOutput(output)
-
-	if debug {
-		log.Printf("Finished processing file: %s\n", file)
-	}
-}
-
-func writeOutput(content string) {
-	outputMu.Lock()
-	defer outputMu.Unlock()
-	output.WriteString(content)
-}
-
-func generateHTMLContent(content string) string {
-	return fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>App Tree Analysis</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; padding: 20px; }
-        h1 { color: #333; }
-        h2 { color: #0066cc; }
-        h3 { color: #009900; }
-        pre { background-color: #f4f4f4; padding: 10px; border-radius: 5px; overflow-x: auto; }
-    </style>
-</head>
-<body>
-    <h1>App Tree Analysis</h1>
-    <pre>%s</pre>
-</body>
-</html>
-`, template.HTMLEscapeString(content))
-}
\ No newline at end of file
+		fn(content[:i])
+		content = content[i+1:]
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// runMainEnv, when set, makes the test binary run the command instead of
+// the tests, so each test run of app-tree starts from fresh global state.
+const runMainEnv = "APP_TREE_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	code := m.Run()
+	if benchTreeBase != "" {
+		os.RemoveAll(benchTreeBase)
+	}
+	os.Exit(code)
+}
+
+// fixtureFiles are the regular files of the fixture project, relative to
+// its root.
+var fixtureFiles = map[string]string{
+	"README.md":              "# Demo\n\nA fixture project.\n",
+	"go.mod":                 "module example.com/demo\n\ngo 1.21\n",
+	"main.go":                "package main\n\nimport \"example.com/demo/internal/util\"\n\nfunc main() {\n\tutil.Greet(\"<world>\")\n}\n",
+	"main_test.go":           "package main\n\nimport \"testing\"\n\nfunc TestMain(t *testing.T) {}\n",
+	"internal/util/util.go":  "package util\n\nimport \"fmt\"\n\n// Greet prints a greeting.\nfunc Greet(name string) {\n\tfmt.Println(\"hello\", name)\n}\n",
+	"internal/util/noeol.go": "package util",
+	"docs/guide/intro.md":    "# Intro\r\nWindows line endings.  \r\n",
+	"config/app.json":        "{\n  \"name\": \"demo\",\n  \"port\": 8080\n}\n",
+	".env.example":           "TOKEN=changeme\n",
+	".hidden/notes.txt":      "hidden notes\n",
+	"assets/logo.png":        "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01",
+	"assets/data.bin":        "\x00\x01\x02\x03\xff\xfe",
+	"empty.txt":              "",
+}
+
+// writeFixture creates the fixture project in a temporary directory and
+// returns its root, named proj. It holds text and binary files, nested and
+// hidden directories, an empty file, a symlink to a file and a symlink
+// looping back to the root. Tests are skipped where symlinks can't be
+// created.
+func writeFixture(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "proj")
+	for name, content := range fixtureFiles {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("main.go", filepath.Join(root, "link.go")); err != nil {
+		t.Skipf("creating the fixture's symlinks: %v", err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "internal", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// runApp runs app-tree with args, writing its output to a fresh directory,
+// and returns that directory and what the command printed.
+func runApp(t *testing.T, args ...string) (outDir string, printed string) {
+	t.Helper()
+	outDir = t.TempDir()
+	cmd := exec.Command(os.Args[0], append(args, "--output-dir", outDir)...)
+	cmd.Dir = outDir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("app-tree %s: %v\n%s", strings.Join(args, " "), err, out.String())
+	}
+	return outDir, out.String()
+}
+
+// readOutput returns the content of the output file name written to dir.
+func readOutput(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checkGolden compares got with testdata/golden/name, or rewrites the file
+// with -update.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (run go test -update to accept it)\n%s", path, diffLines(string(want), got))
+	}
+}
+
+// diffLines describes the first line where got departs from want.
+func diffLines(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n- %q\n+ %q", i+1, w, g)
+		}
+	}
+	return "no line differs"
+}
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// output is the file the command writes, app_tree_prompt.txt by
+		// default.
+		output string
+	}{
+		{name: "text"},
+		{name: "html", args: []string{"--format", "html"}, output: "app_tree.html"},
+		{name: "jsonl", args: []string{"--format", "jsonl"}, output: "app_tree.jsonl"},
+		{name: "embeddings", args: []string{"--format", "embeddings", "--chunk-tokens", "8"}, output: "app_tree_embeddings.json"},
+		{name: "skeleton", args: []string{"--format", "skeleton"}, output: "app_tree_skeleton.json"},
+		{name: "dot", args: []string{"--format", "dot", "--dot-sizes"}, output: "app_tree.dot"},
+		{name: "json", args: []string{"--format", "json"}, output: "app_tree.json"},
+		{name: "markdown", args: []string{"--format", "markdown"}, output: "app_tree.md"},
+		{name: "flatten-depth", args: []string{"--format", "markdown", "--flatten-depth", "2"}, output: "app_tree.md"},
+		{name: "no-header", args: []string{"--no-header"}},
+		{name: "sections", args: []string{"--prompt-style", "sections", "--collapse-chains"}},
+		{name: "no-binary", args: []string{"--no-binary", "--include-empty-files=false"}},
+		{name: "head", args: []string{"--head", "1"}},
+		{name: "normalize", args: []string{"--trim-trailing-whitespace", "--preserve-eof-newline"}},
+		{name: "sort-size", args: []string{"--sort", "size", "--files-first"}},
+		{name: "limit-per-dir", args: []string{"--limit-per-dir", "2"}},
+		{name: "exclude", args: []string{"--exclude", ".*,assets", "--max-depth", "2"}},
+		{name: "name-regex", args: []string{"--name-regex", `\.go$`}},
+		{name: "smart", args: []string{"--smart"}},
+		{name: "du", args: []string{"--du"}},
+		{name: "size-histogram", args: []string{"--size-histogram"}},
+		{name: "rank", args: []string{"--rank", "--rank-rule", "internal/*/util.go=0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFixture(t)
+			args := append([]string{root, "--deterministic", "--no-precount"}, tt.args...)
+			dir, _ := runApp(t, args...)
+			output := tt.output
+			if output == "" {
+				output = "app_tree_prompt.txt"
+			}
+			checkGolden(t, tt.name+".golden", readOutput(t, dir, output))
+		})
+	}
+}
+
+// TestPermissionDenied checks that a directory that can't be listed is
+// marked in the output and counted in the summary, and that the traversal
+// carries on with the directories after it.
+func TestPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits don't restrict listing directories on Windows")
+	}
+	root := filepath.Join(t.TempDir(), "proj")
+	locked := filepath.Join(root, "locked")
+	for _, dir := range []string{locked, filepath.Join(root, "open")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "open", "after.txt"), []byte("read after the locked directory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("mode 0000 doesn't stop this user listing directories")
+	}
+
+	dir, printed := runApp(t, root)
+	got := readOutput(t, dir, "app_tree_prompt.txt")
+	for _, want := range []string{
+		"locked\n  ==========================\n  [permission denied]\n",
+		"FILE: " + filepath.Join(root, "open", "after.txt") + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if !strings.Contains(printed, "Skipped 1 directories due to permission errors.") {
+		t.Errorf("summary doesn't report the locked directory:\n%s", printed)
+	}
+}
+
+// TestJobs checks that reading files concurrently writes every file exactly
+// once, in the same order as reading them one at a time.
+func TestJobs(t *testing.T) {
+	root := writeFixture(t)
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(root, "many", fmt.Sprintf("file%02d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat(fmt.Sprintf("line %d\n", i), i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, _ := runApp(t, root, "--deterministic", "--no-precount")
+	want := readOutput(t, dir, "app_tree_prompt.txt")
+	for _, jobs := range []string{"2", "8"} {
+		dir, _ := runApp(t, root, "--deterministic", "--no-precount", "--jobs", jobs, "--max-open-files", "3")
+		if got := readOutput(t, dir, "app_tree_prompt.txt"); got != want {
+			t.Errorf("--jobs %s output differs from --jobs 1\n%s", jobs, diffLines(want, got))
+		}
+	}
+	if n := strings.Count(want, "FILE: proj/many/file07.txt\n"); n != 1 {
+		t.Errorf("file07.txt written %d times", n)
+	}
+}
+
+// TestTreeFormatRoots checks that several roots are rendered as a single
+// JSON document holding the tree of each.
+func TestTreeFormatRoots(t *testing.T) {
+	root := writeFixture(t)
+	dir, _ := runApp(t, filepath.Join(root, "internal"), filepath.Join(root, "docs"), "--deterministic", "--no-precount", "--format", "json")
+	var doc struct {
+		Stats struct {
+			Files int `json:"files"`
+		} `json:"stats"`
+		Tree struct {
+			Name     string `json:"name"`
+			Children []struct {
+				Name string `json:"name"`
+			} `json:"children"`
+		} `json:"tree"`
+	}
+	if err := json.Unmarshal([]byte(readOutput(t, dir, "app_tree.json")), &doc); err != nil {
+		t.Fatalf("output isn't a single JSON document: %v", err)
+	}
+	if doc.Tree.Name != "proj" || len(doc.Tree.Children) != 2 || doc.Tree.Children[0].Name != "internal" || doc.Tree.Children[1].Name != "docs" {
+		t.Errorf("got tree %+v, want proj holding internal and docs", doc.Tree)
+	}
+	// The files of both roots count, including the symlink internal/loop.
+	if doc.Stats.Files != 4 {
+		t.Errorf("got %d files, want 4", doc.Stats.Files)
+	}
+}
+
+// TestCompletionMessage checks that the completion message names the
+// output file within --output-dir.
+func TestCompletionMessage(t *testing.T) {
+	root := writeFixture(t)
+	dir, printed := runApp(t, root, "--no-precount")
+	if want := "Output written to: " + filepath.Join(dir, "app_tree_prompt.txt"); !strings.Contains(printed, want) {
+		t.Errorf("output lacks %q:\n%s", want, printed)
+	}
+}
+
+// TestCacheRuleFile checks that editing --rule-file invalidates the
+// blocks --cache kept, though the command line is the same.
+func TestCacheRuleFile(t *testing.T) {
+	root := writeFixture(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	rules := filepath.Join(t.TempDir(), "rules.cel")
+	outDir := t.TempDir()
+	run := func(rule string) string {
+		t.Helper()
+		if err := os.WriteFile(rules, []byte(rule), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The command line, --output-dir included, must be the same for
+		// the runs to share the cache.
+		cmd := exec.Command(os.Args[0], root, "--deterministic", "--no-precount", "--no-header", "--cache", "--rule-file", rules, "--name-regex", `^README\.md$`, "--output-dir", outDir)
+		cmd.Env = append(os.Environ(), runMainEnv+"=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("app-tree: %v\n%s", err, out)
+		}
+		return readOutput(t, outDir, "app_tree_prompt.txt")
+	}
+	run(`name == "README.md" ? "header" : "include"`)
+	if got := run(`"include"`); !strings.Contains(got, "A fixture project.") {
+		t.Errorf("cached header-only block reused after the rules changed:\n%s", got)
+	}
+}
+
+// TestPreserveEOFNewline checks that the final newline of emitted content
+// matches the source with --preserve-eof-newline.
+func TestPreserveEOFNewline(t *testing.T) {
+	root := writeFixture(t)
+	dir, _ := runApp(t, root, "--deterministic", "--no-precount", "--no-header", "--preserve-eof-newline", "--name-regex", `^(noeol|util)\.go$`)
+	got := readOutput(t, dir, "app_tree_prompt.txt")
+
+	for _, want := range []string{
+		"=== proj/internal/util/noeol.go ===\npackage util\n\\ No newline at end of file\n",
+		"=== proj/internal/util/util.go ===\n" + fixtureFiles["internal/util/util.go"],
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "}\n\n") {
+		t.Errorf("a blank line follows the final newline of util.go:\n%s", got)
+	}
+}
+
+// TestExplain checks that --explain names the rule deciding each entry,
+// once per entry.
+func TestExplain(t *testing.T) {
+	root := writeFixture(t)
+	_, printed := runApp(t, root, "--deterministic", "--no-precount", "--explain", "--exclude", "assets", "--name-regex", `\.go$`)
+
+	for _, want := range []string{
+		"proj/assets/: excluded by --exclude\n",
+		"proj/README.md: excluded as not matching --name-regex\n",
+		"proj/main.go: included by --name-regex\n",
+		"proj/internal/: included as no filter excludes it\n",
+	} {
+		if n := strings.Count(printed, want); n != 1 {
+			t.Errorf("output holds %q %d times, want once:\n%s", want, n, printed)
+		}
+	}
+}
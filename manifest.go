@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+var manifestOnly bool
+
+// manifestRecord is one line of the --manifest-only output.
+type manifestRecord struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mtime"`
+	Hash    string `json:"hash"`
+	// file is the path the record was made from.
+	file string
+}
+
+// runManifestOnly walks roots applying the analysis filters and prints a
+// JSON line with the size, modification time and SHA-256 of every file,
+// without any content. Records are sorted by path and times are in UTC, so
+// manifests of the same tree are identical and diff cleanly.
+func runManifestOnly(roots []string) {
+	for _, r := range collectManifest(roots) {
+		data, err := json.Marshal(r)
+		if err != nil {
+			slog.Error("Error encoding manifest", "path", r.Path, "err", err)
+			continue
+		}
+		fmt.Println(string(data))
+	}
+}
+
+// collectManifest returns the manifest records of the files the analysis of
+// roots visits, sorted by path.
+func collectManifest(roots []string) []manifestRecord {
+	var records []manifestRecord
+	for _, root := range roots {
+		walkRoot(root, func(path string, info os.FileInfo, err error) {
+			if err != nil {
+				slog.Error("Error accessing path", "path", path, "err", err)
+				return
+			}
+			if info.IsDir() {
+				return
+			}
+
+			content, release, err := readFileContent(path)
+			if err != nil {
+				slog.Error("Error reading file", "path", path, "err", err)
+				return
+			}
+			hash := contentHash(content)
+			release()
+			records = append(records, manifestRecord{
+				Path:    displayPath(path),
+				Size:    info.Size(),
+				ModTime: info.ModTime().UTC().Format(time.RFC3339Nano),
+				Hash:    hash,
+				file:    path,
+			})
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	return records
+}
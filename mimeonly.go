@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var mimeOnly bool
+
+// runMimeOnly walks roots applying the analysis filters and prints the
+// resolved type of each file with the method that detected it: override,
+// extension, magic or heuristic.
+func runMimeOnly(roots []string) {
+	for _, root := range roots {
+		walkRoot(root, func(path string, info os.FileInfo, err error) {
+			if err != nil {
+				slog.Error("Error accessing path", "path", path, "err", err)
+				return
+			}
+			if info.IsDir() {
+				return
+			}
+
+			fileType, method := detectPathTypeMethod(path)
+			fmt.Printf("%s\t%s\t%s\n", displayPath(path), fileType, method)
+		})
+	}
+}
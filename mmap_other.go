@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func mmapFile(file string) ([]byte, func(), error) {
+	return nil, nil, errors.New("mmap is not supported on this platform")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"sync"
+	"unicode"
+)
+
+const (
+	// shingleSize is the number of consecutive tokens hashed together, so
+	// reordered code reads as different while small edits change little.
+	shingleSize = 3
+	// minShingles is the fewest shingles a file needs to be fingerprinted;
+	// smaller files are too short for similarity to mean anything.
+	minShingles = 20
+	// nearDupeDistance is the largest number of differing fingerprint bits
+	// for two files to be considered near duplicates.
+	nearDupeDistance = 3
+)
+
+var (
+	nearDupes        bool
+	fingerprintMu    sync.Mutex
+	fingerprintPaths []string
+	fingerprints     []uint64
+)
+
+// recordFingerprint remembers the SimHash of a text file for
+// printNearDuplicates.
+func recordFingerprint(file string, content []byte) {
+	hash, ok := simHash(content)
+	if !ok {
+		return
+	}
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	fingerprintPaths = append(fingerprintPaths, file)
+	fingerprints = append(fingerprints, hash)
+}
+
+// simHash returns a 64-bit SimHash of content built from shingles of its
+// word tokens. Similar content yields fingerprints that differ in few bits.
+// ok is false when content is too short to fingerprint.
+func simHash(content []byte) (hash uint64, ok bool) {
+	tokens := bytes.FieldsFunc(content, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if len(tokens)-shingleSize+1 < minShingles {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(tokens); i++ {
+		h := fnv.New64a()
+		for _, token := range tokens[i : i+shingleSize] {
+			h.Write(token)
+			h.Write([]byte{0})
+		}
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash, true
+}
+
+// nearDuplicateClusters groups the fingerprinted files whose fingerprints
+// are within nearDupeDistance of another file in the group. Every pair is
+// compared, which is why --near-dupes is opt-in.
+func nearDuplicateClusters() [][]string {
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+
+	parent := make([]int, len(fingerprints))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range fingerprints {
+		for j := i + 1; j < len(fingerprints); j++ {
+			if bits.OnesCount64(fingerprints[i]^fingerprints[j]) <= nearDupeDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int][]string{}
+	for i, path := range fingerprintPaths {
+		root := find(i)
+		groups[root] = append(groups[root], path)
+	}
+	var clusters [][]string
+	for _, group := range groups {
+		if len(group) > 1 {
+			sort.Strings(group)
+			clusters = append(clusters, group)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
+
+// printNearDuplicates prints the clusters of highly similar files, largest
+// first.
+func printNearDuplicates() {
+	clusters := nearDuplicateClusters()
+	if len(clusters) == 0 {
+		fmt.Println("\nNo near-duplicate files found.")
+		return
+	}
+	fmt.Println("\nNear-duplicate files:")
+	for i, cluster := range clusters {
+		fmt.Printf("  Cluster %d (%d files):\n", i+1, len(cluster))
+		for _, path := range cluster {
+			fmt.Printf("    %s\n", displayPath(path))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// notebook is the part of a Jupyter notebook worth showing: the source of
+// its cells. Outputs, often base64 images, are left out.
+type notebook struct {
+	Cells []struct {
+		CellType string          `json:"cell_type"`
+		Source   json.RawMessage `json:"source"`
+	} `json:"cells"`
+}
+
+// isNotebook reports whether file is a Jupyter notebook.
+func isNotebook(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".ipynb")
+}
+
+// notebookText renders the cells of a notebook as text, each cell
+// introduced by a "# %% [type]" marker as used by Jupytext.
+func notebookText(content []byte) ([]byte, error) {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, err
+	}
+	if nb.Cells == nil {
+		return nil, errors.New("no cells")
+	}
+
+	var b strings.Builder
+	for i, cell := range nb.Cells {
+		source, err := notebookSource(cell.Source)
+		if err != nil {
+			return nil, fmt.Errorf("cell %d: %w", i+1, err)
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %%%% [%s]\n", cell.CellType)
+		b.WriteString(source)
+		if source != "" && !strings.HasSuffix(source, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// notebookSource decodes a cell source, which notebooks store either as a
+// string or as a list of lines.
+func notebookSource(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, ""), nil
+}
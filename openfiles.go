@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// maxOpenFiles bounds the files open at once across concurrent reads. It is
+// kept well below common descriptor limits, which start at 256 on macOS.
+var maxOpenFiles = 64
+
+// openFileSlots holds a token for every open file, or is nil when reads are
+// not limited.
+var openFileSlots chan struct{}
+
+// limitOpenFiles sets up the --max-open-files semaphore.
+func limitOpenFiles() error {
+	if maxOpenFiles < 1 {
+		return fmt.Errorf("--max-open-files must be at least 1, got %d", maxOpenFiles)
+	}
+	openFileSlots = make(chan struct{}, maxOpenFiles)
+	return nil
+}
+
+// acquireFile waits until another file may be opened and returns the
+// function releasing its slot, to be called once the file is closed.
+func acquireFile() func() {
+	if openFileSlots == nil {
+		return func() {}
+	}
+	openFileSlots <- struct{}{}
+	return func() { <-openFileSlots }
+}
+
+// errTooManyOpenFiles marks reads that failed because the process ran out of
+// file descriptors.
+var errTooManyOpenFiles = errors.New("too many open files (lower --max-open-files or --jobs, or raise the limit with ulimit -n)")
+
+// explainOpenError adds a remediation hint to err when the operating
+// system's limit on open files was hit.
+func explainOpenError(err error) error {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		return fmt.Errorf("%w: %w", errTooManyOpenFiles, err)
+	}
+	return err
+}
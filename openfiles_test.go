@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAcquireFile(t *testing.T) {
+	defer func(n int) {
+		maxOpenFiles, openFileSlots = n, nil
+	}(maxOpenFiles)
+
+	maxOpenFiles = 0
+	if err := limitOpenFiles(); err == nil {
+		t.Error("--max-open-files 0 was accepted")
+	}
+
+	maxOpenFiles = 2
+	if err := limitOpenFiles(); err != nil {
+		t.Fatal(err)
+	}
+	release1, release2 := acquireFile(), acquireFile()
+
+	acquired := make(chan func())
+	go func() { acquired <- acquireFile() }()
+	select {
+	case <-acquired:
+		t.Fatal("a third file was opened while two were")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release1()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("releasing a file didn't let another open")
+	}
+	release2()
+}
+
+func TestExplainOpenError(t *testing.T) {
+	for _, err := range []error{syscall.EMFILE, syscall.ENFILE, fmt.Errorf("open x: %w", syscall.EMFILE)} {
+		if got := explainOpenError(err); !errors.Is(got, errTooManyOpenFiles) || !errors.Is(got, err) {
+			t.Errorf("explainOpenError(%v) = %v", err, got)
+		}
+	}
+	if got := explainOpenError(syscall.ENOENT); got != syscall.ENOENT {
+		t.Errorf("explainOpenError(ENOENT) = %v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestOpenFilesNearLimit lowers the process's descriptor limit to just
+// above what is open, then reads files until it is hit, checking that the
+// failure carries the remediation hint.
+func TestOpenFilesNearLimit(t *testing.T) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Skipf("reading the descriptor limit: %v", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Descriptors are allocated lowest first, so a fresh one tells how many
+	// are in use.
+	probe, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inUse := probe.Fd()
+	probe.Close()
+
+	lowered := limit
+	lowered.Cur = uint64(inUse) + 8
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skipf("lowering the descriptor limit: %v", err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+
+	var open []*os.File
+	defer func() {
+		for _, f := range open {
+			f.Close()
+		}
+	}()
+	for i := 0; i < 64; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			if !errors.Is(err, syscall.EMFILE) {
+				t.Fatalf("opening file %d: %v", i, err)
+			}
+			break
+		}
+		open = append(open, f)
+	}
+
+	_, _, err = readFileContent(path)
+	if !errors.Is(err, errTooManyOpenFiles) {
+		t.Errorf("reading at the limit returned %v, want errTooManyOpenFiles", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+const (
+	sortByName  = apptree.SortName
+	sortBySize  = apptree.SortSize
+	sortByMtime = apptree.SortModTime
+)
+
+var (
+	dirsFirst  bool
+	filesFirst bool
+	sortKey    = sortByName
+)
+
+// validateSortKey checks the value given to --sort.
+func validateSortKey() error {
+	switch sortKey {
+	case sortByName, sortBySize, sortByMtime:
+		return nil
+	}
+	return fmt.Errorf("invalid sort key %q, expected name, size or mtime", sortKey)
+}
+
+// sortsBefore reports whether a ranks before b under --sort size or mtime,
+// largest and newest first, for orders across directories. Names are
+// compared by the caller.
+func sortsBefore(a, b os.FileInfo) bool {
+	switch sortKey {
+	case sortBySize:
+		return a.Size() > b.Size()
+	case sortByMtime:
+		return a.ModTime().After(b.ModTime())
+	}
+	return false
+}
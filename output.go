@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	outputMu   sync.Mutex
+	output     io.Writer
+	rawOutput  io.Writer
+	outputErr  error
+	outputPath string
+	// outputBuf and outputFile are where output is buffered and written,
+	// for flushOutput and outputOffset.
+	outputBuf  *bufio.Writer
+	outputFile *countingWriter
+	// noTempFile keeps the output of --serve in servedOutput instead of
+	// writing it to disk.
+	noTempFile   bool
+	servedOutput *bytes.Buffer
+	// stdout is where the output goes with --output-dir -. os.Stdout points
+	// at stderr meanwhile, so messages and progress don't mix with it.
+	stdout = os.Stdout
+	// contentWriter writes the blocks of the traversal to the output in a
+	// streaming format; it is nil for tree formats.
+	contentWriter *apptree.ContentWriter
+)
+
+// stdoutPath is the --output-dir value that writes the output to stdout.
+const stdoutPath = "-"
+
+// redirectMessagesToStderr makes messages printed to os.Stdout go to stderr,
+// keeping stdout for the output. The returned function undoes it.
+func redirectMessagesToStderr() func() {
+	stdout = os.Stdout
+	os.Stdout = os.Stderr
+	return func() { os.Stdout = stdout }
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openOutput creates the output file at path and makes it the destination of
+// writeOutput, so content is streamed to disk as the traversal proceeds. The
+// returned function finishes the document and closes the file. With
+// --no-temp-file the output is kept in servedOutput instead.
+//
+// A path of stdoutPath writes the output to stdout.
+//
+// When the checkpoint is resuming, the output of the interrupted run is
+// kept up to the checkpoint and continued instead.
+func openOutput(path string) (func() error, error) {
+	var err error
+	if path != stdoutPath {
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	}
+	var r apptree.StreamRenderer
+	if !isTreeFormat() {
+		if r, err = apptree.NewStreamRenderer(outputFormat, analysisOptions.Framing); err != nil {
+			return nil, err
+		}
+		if err := checkpoint.keepState(r); err != nil {
+			return nil, err
+		}
+	}
+	var f *os.File
+	var dst io.Writer
+	offset := checkpoint.resumedOffset()
+	switch {
+	case noTempFile || path == stdoutPath && outputFormat == formatPDF:
+		servedOutput = &bytes.Buffer{}
+		dst = servedOutput
+	case path == stdoutPath:
+		dst = stdout
+	case outputFormat == formatPDF:
+		// Pages are laid out from the text rendering once it is complete.
+		f, err = os.CreateTemp("", "app-tree-*.txt")
+	case offset > 0:
+		f, err = os.OpenFile(path, os.O_WRONLY, 0)
+		if err == nil {
+			if err = f.Truncate(offset); err == nil {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+		}
+	default:
+		f, err = os.Create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		dst = f
+	}
+	outputPath = path
+
+	outputFile = &countingWriter{w: dst, n: offset}
+	w := bufio.NewWriter(outputFile)
+	outputBuf = w
+	output = w
+	rawOutput = w
+	if outputFormat == formatHTML {
+		output = htmlEscapeWriter{w}
+	}
+	// Each output starts its own document when --split-by-dir writes several.
+	contentWriter = nil
+	if r != nil {
+		r = checkpointRenderer{r}
+		if offset == 0 {
+			r.Begin(outputWriter{})
+		}
+		contentWriter = apptree.NewContentWriter(analysisCtx, outputWriter{}, r, analysisOptions)
+	}
+
+	return func() error {
+		if r != nil {
+			if err := contentWriter.Err(); err != nil && outputErr == nil {
+				outputErr = err
+			}
+			if err := r.End(outputWriter{}); err != nil && outputErr == nil {
+				outputErr = err
+			}
+		}
+		if err := w.Flush(); err != nil && outputErr == nil {
+			outputErr = err
+		}
+		if f == nil {
+			if outputFormat == formatPDF && outputErr == nil {
+				text := servedOutput
+				servedOutput = &bytes.Buffer{}
+				outputErr = writeTextPDF(servedOutput, text)
+				if path == stdoutPath && outputErr == nil {
+					_, outputErr = servedOutput.WriteTo(stdout)
+				}
+			}
+			return outputErr
+		}
+		if err := f.Close(); err != nil && outputErr == nil {
+			outputErr = err
+		}
+		if outputFormat == formatPDF {
+			if outputErr == nil {
+				outputErr = convertToPDF(f.Name(), path)
+			}
+			os.Remove(f.Name())
+		}
+		return outputErr
+	}, nil
+}
+
+// writeNote writes n among the blocks of the output, as its format writes
+// notes. Tree formats have no place for them.
+func writeNote(n apptree.Note) {
+	if contentWriter != nil {
+		contentWriter.Note(n)
+	}
+}
+
+func writeOutput(content string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if outputErr != nil {
+		return
+	}
+	_, outputErr = io.WriteString(output, content)
+}
+
+// flushOutput writes buffered output to the file.
+func flushOutput() error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if outputErr != nil {
+		return outputErr
+	}
+	outputErr = outputBuf.Flush()
+	return outputErr
+}
+
+// outputOffset returns the length of the output written so far, including
+// what is still buffered.
+func outputOffset() int64 {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	return outputFile.n + int64(outputBuf.Buffered())
+}
+
+// outputWriter writes the output of the content writer as is.
+type outputWriter struct{}
+
+func (outputWriter) Write(p []byte) (int, error) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if outputErr != nil {
+		return 0, outputErr
+	}
+	var n int
+	n, outputErr = rawOutput.Write(p)
+	return n, outputErr
+}
+
+// htmlEscapeWriter escapes everything written through it for inclusion in
+// the HTML page body.
+type htmlEscapeWriter struct {
+	w io.Writer
+}
+
+func (h htmlEscapeWriter) Write(p []byte) (int, error) {
+	template.HTMLEscape(h.w, p)
+	return len(p), nil
+}
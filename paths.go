@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	pathStyleNative = "native"
+	pathStyleUnix   = "unix"
+)
+
+var (
+	relativeTo    string
+	pathStyle     = pathStyleNative
+	deterministic bool
+)
+
+// validatePathStyle checks the value given to --path-style.
+func validatePathStyle() error {
+	switch pathStyle {
+	case pathStyleNative, pathStyleUnix:
+		return nil
+	}
+	return fmt.Errorf("invalid path style %q, expected native or unix", pathStyle)
+}
+
+// applyDeterministic makes emitted paths independent of where roots live on
+// disk and of the platform, so identical trees produce identical output.
+// Paths are shown relative to the directory containing the roots, unless
+// --relative-to was given, and always use forward slashes.
+func applyDeterministic(roots []string) {
+	if relativeTo == "" {
+		relativeTo = commonParent(roots)
+	}
+	pathStyle = pathStyleUnix
+}
+
+// commonParent returns the deepest directory containing the parents of all
+// roots.
+func commonParent(roots []string) string {
+	parent := filepath.Dir(roots[0])
+	for _, root := range roots[1:] {
+		dir := filepath.Dir(root)
+		for parent != dir && !strings.HasPrefix(dir, parent+string(filepath.Separator)) && parent != filepath.Dir(parent) {
+			parent = filepath.Dir(parent)
+		}
+	}
+	return parent
+}
+
+// displayPath formats path for output, relative to --relative-to when set
+// and with forward slashes under --path-style unix.
+func displayPath(path string) string {
+	if relativeTo != "" {
+		if rel, err := filepath.Rel(relativeTo, path); err == nil {
+			path = rel
+		}
+	}
+	if pathStyle == pathStyleUnix {
+		return filepath.ToSlash(path)
+	}
+	return path
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCommonParent(t *testing.T) {
+	tests := []struct {
+		roots []string
+		want  string
+	}{
+		{[]string{"/src/app"}, "/src"},
+		{[]string{"/src/app", "/src/lib"}, "/src"},
+		{[]string{"/src/a/app", "/src/b/lib"}, "/src"},
+		{[]string{"/src/app", "/other/lib"}, "/"},
+	}
+	for _, tt := range tests {
+		roots := make([]string, len(tt.roots))
+		for i, root := range tt.roots {
+			roots[i] = filepath.FromSlash(root)
+		}
+		if got := filepath.ToSlash(commonParent(roots)); got != tt.want {
+			t.Errorf("commonParent(%q) = %q, want %q", tt.roots, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayPath(t *testing.T) {
+	defer func(rel, style string) {
+		relativeTo, pathStyle = rel, style
+	}(relativeTo, pathStyle)
+
+	path := filepath.FromSlash("/src/app/main.go")
+	tests := []struct {
+		relativeTo, pathStyle, want string
+	}{
+		{"", pathStyleNative, path},
+		{"", pathStyleUnix, "/src/app/main.go"},
+		{filepath.FromSlash("/src"), pathStyleUnix, "app/main.go"},
+	}
+	for _, tt := range tests {
+		relativeTo, pathStyle = tt.relativeTo, tt.pathStyle
+		if got := displayPath(path); got != tt.want {
+			t.Errorf("displayPath with --relative-to %q --path-style %s = %q, want %q", tt.relativeTo, tt.pathStyle, got, tt.want)
+		}
+	}
+}
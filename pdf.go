@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// Page layout of --format pdf: A4 in points with a monospaced font.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 36
+	pdfFontSize   = 8
+	pdfLineHeight = 10
+
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	// Courier glyphs advance by 3/5 of the font size.
+	pdfCharsPerLine = (pdfPageWidth - 2*pdfMargin) * 5 / (pdfFontSize * 3)
+)
+
+// The pdf format is laid out from the text rendering.
+func init() {
+	apptree.RegisterStream(formatPDF, func(fr apptree.Framing) apptree.StreamRenderer {
+		r, _ := apptree.NewStreamRenderer(apptree.FormatText, fr)
+		return r
+	})
+}
+
+// convertToPDF lays out the text rendering at textPath as a PDF at path.
+func convertToPDF(textPath, path string) error {
+	in, err := os.Open(textPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	if err := writeTextPDF(w, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeTextPDF writes text as a PDF document with a simple monospaced
+// layout, wrapping long lines and breaking pages as needed.
+func writeTextPDF(w io.Writer, text io.Reader) error {
+	var pages [][]string
+	var page []string
+	addLine := func(line string) {
+		if len(page) == pdfLinesPerPage {
+			pages = append(pages, page)
+			page = nil
+		}
+		page = append(page, line)
+	}
+
+	scanner := bufio.NewScanner(text)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		// The text rendering escapes content for HTML.
+		line := []rune(strings.ReplaceAll(html.UnescapeString(scanner.Text()), "\t", "    "))
+		for len(line) > pdfCharsPerLine {
+			addLine(string(line[:pdfCharsPerLine]))
+			line = line[pdfCharsPerLine:]
+		}
+		addLine(string(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if page != nil || len(pages) == 0 {
+		pages = append(pages, page)
+	}
+
+	pw := &pdfWriter{w: w}
+	pw.printf("%%PDF-1.4\n")
+
+	// Objects 1-3 are the catalog, the page tree and the font, followed by a
+	// page object and a content stream for every page.
+	pw.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	pw.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	pw.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		pageObj, contentObj := 4+2*i, 5+2*i
+		pw.object(pageObj, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, contentObj))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin-pdfFontSize)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+		pw.object(contentObj, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, off := range pw.offsets {
+		pw.printf("%010d 00000 n \n", off)
+	}
+	pw.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, xref)
+	return pw.err
+}
+
+// pdfWriter tracks the byte offsets of the objects it writes for the
+// cross-reference table.
+type pdfWriter struct {
+	w       io.Writer
+	n       int
+	offsets []int
+	err     error
+}
+
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.n += n
+	pw.err = err
+}
+
+// object writes object number id, which must follow the previous one.
+func (pw *pdfWriter) object(id int, body string) {
+	pw.offsets = append(pw.offsets, pw.n)
+	pw.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// pdfEscape encodes s as the contents of a PDF string in WinAnsiEncoding,
+// replacing characters outside Latin-1 with '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	pickDirs bool
+	// unpickedDirs holds the top-level directories left out with --pick.
+	unpickedDirs map[string]bool
+)
+
+// pickDirectories lists the top-level directories of roots on out and reads
+// the ones to include from in. Directories that aren't picked are left out by
+// selectEntry.
+func pickDirectories(roots []string, in io.Reader, out io.Writer) error {
+	var dirs []string
+	for _, root := range roots {
+		opts := rootOptions(root)
+		opts.MaxDepth = 1
+		tree, err := apptree.Analyze(opts)
+		if err == nil {
+			err = tree.Err
+		}
+		if err != nil {
+			return err
+		}
+		for _, n := range tree.Children {
+			if n.Dir {
+				dirs = append(dirs, n.Path)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(out, "Top-level directories:")
+	for i, dir := range dirs {
+		fmt.Fprintf(out, "  %3d) %s\n", i+1, displayPath(dir))
+	}
+	fmt.Fprint(out, "Directories to include (e.g. 1,3-5; empty for all): ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	picked, err := parseSelection(strings.TrimSpace(line), len(dirs))
+	if err != nil {
+		return err
+	}
+	if picked == nil {
+		return nil
+	}
+
+	unpickedDirs = map[string]bool{}
+	for i, dir := range dirs {
+		if !picked[i+1] {
+			unpickedDirs[dir] = true
+		}
+	}
+	return nil
+}
+
+// parseSelection parses a comma-separated list of numbers and ranges between
+// 1 and n. An empty selection returns nil, meaning everything.
+func parseSelection(s string, n int) (map[int]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	picked := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("invalid selection %q", part)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("selection %q is out of range 1-%d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			picked[i] = true
+		}
+	}
+	return picked, nil
+}
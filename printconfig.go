@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+var printConfig bool
+
+// effectiveConfig is the configuration printed by --print-config.
+type effectiveConfig struct {
+	Roots []string `json:"roots"`
+	// Flags holds the value of every flag, defaults included, and SetFlags
+	// names the ones given on the command line.
+	Flags        map[string]interface{} `json:"flags"`
+	SetFlags     []string               `json:"set_flags"`
+	ProjectTypes []string               `json:"project_types"`
+	ExcludedDirs []string               `json:"excluded_dirs,omitempty"`
+	IgnoreFiles  []ignoreFileConfig     `json:"ignore_files,omitempty"`
+}
+
+// ignoreFileConfig lists the patterns of an ignore file that apply to the
+// analysis.
+type ignoreFileConfig struct {
+	Path     string   `json:"path"`
+	Patterns []string `json:"patterns"`
+}
+
+// runPrintConfig prints the configuration the analysis of roots would use
+// as JSON: the flags, the detected project types, the directories skipped
+// by --smart and --pick, and the patterns of the .gitignore and
+// .promptignore files at the roots and, for .gitignore, up to their bases.
+func runPrintConfig(flags *pflag.FlagSet, roots []string) error {
+	config := effectiveConfig{Roots: make([]string, len(roots)), Flags: map[string]interface{}{}, SetFlags: []string{}, ProjectTypes: []string{}}
+	for i, root := range roots {
+		config.Roots[i] = displayPath(root)
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		config.Flags[f.Name] = flagValue(f)
+		if f.Changed {
+			config.SetFlags = append(config.SetFlags, f.Name)
+		}
+	})
+
+	if len(forcedProjectTypes) > 0 {
+		config.ProjectTypes = append(config.ProjectTypes, forcedProjectTypes...)
+	} else {
+		seen := map[string]bool{}
+		for _, root := range roots {
+			for _, t := range detectProjectTypes(root) {
+				if !seen[t.name] {
+					seen[t.name] = true
+					config.ProjectTypes = append(config.ProjectTypes, t.name)
+				}
+			}
+		}
+	}
+	for name := range smartExcludeDirs {
+		config.ExcludedDirs = append(config.ExcludedDirs, name)
+	}
+	for dir := range unpickedDirs {
+		config.ExcludedDirs = append(config.ExcludedDirs, displayPath(dir))
+	}
+	sort.Strings(config.ExcludedDirs)
+
+	for _, root := range roots {
+		if useGitignore {
+			for dir := root; ; dir = filepath.Dir(dir) {
+				config.addIgnoreFile(filepath.Join(dir, ".gitignore"), parseGitignoreLine)
+				if dir == gitignoreBases[root] || dir == filepath.Dir(dir) {
+					break
+				}
+			}
+		}
+		if usePromptignore {
+			config.addIgnoreFile(filepath.Join(root, ".promptignore"), parsePromptignoreLine)
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// flagValue returns the value of f as the JSON type matching the flag's:
+// booleans, numbers and lists of strings. Other values, such as durations,
+// are given as their string form.
+func flagValue(f *pflag.Flag) interface{} {
+	value := f.Value.String()
+	switch f.Value.Type() {
+	case "bool":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "int", "int64":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "stringSlice", "stringArray":
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			return append([]string{}, s.GetSlice()...)
+		}
+	}
+	return value
+}
+
+// addIgnoreFile lists the lines of the ignore file at path that parse
+// accepts, if it exists.
+func (c *effectiveConfig) addIgnoreFile(path string, parse func(line string) (gitignoreRule, bool)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	file := ignoreFileConfig{Path: displayPath(path), Patterns: []string{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if _, ok := parse(scanner.Text()); ok {
+			file.Patterns = append(file.Patterns, strings.TrimSpace(scanner.Text()))
+		}
+	}
+	c.IgnoreFiles = append(c.IgnoreFiles, file)
+}
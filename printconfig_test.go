@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestPrintConfigTypes checks that --print-config gives flag values as
+// JSON booleans, numbers and arrays rather than strings.
+func TestPrintConfigTypes(t *testing.T) {
+	root := t.TempDir()
+	cmd := exec.Command(os.Args[0], root, "--print-config", "--max-depth", "2", "--exclude", "a,b", "--sample", "3")
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("app-tree --print-config: %v", err)
+	}
+
+	var config struct {
+		Flags map[string]interface{} `json:"flags"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatalf("parsing the configuration: %v\n%s", err, out)
+	}
+	for name, want := range map[string]interface{}{
+		"max-depth": float64(2),
+		"sample":    float64(3),
+		"gzip":      false,
+		"host":      "localhost",
+		"timeout":   "0s",
+	} {
+		if got := config.Flags[name]; got != want {
+			t.Errorf("flag %s is %#v, want %#v", name, got, want)
+		}
+	}
+	exclude, ok := config.Flags["exclude"].([]interface{})
+	if !ok || len(exclude) < 2 || exclude[len(exclude)-2] != "a" || exclude[len(exclude)-1] != "b" {
+		t.Errorf("flag exclude is %#v, want a list ending with a and b", config.Flags["exclude"])
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// progress wraps the progress bar so traversal can start with an
+// indeterminate spinner and switch to a regular bar once the total number of
+// items is known. It also tracks the bytes processed to show throughput.
+//
+// Updates may come from any goroutine. They are sent over a channel to a
+// single goroutine that owns the bar, so reporting progress never waits on
+// rendering and the bar is never touched concurrently.
+type progress struct {
+	updates chan progressUpdate
+	// done is closed once the owning goroutine has finished the bar.
+	done chan struct{}
+
+	// The fields below are owned by the goroutine running run.
+	bar     *progressbar.ProgressBar
+	current int64
+	bytes   int64
+	start   time.Time
+}
+
+// progressUpdate is one change to the progress: items and bytes processed,
+// a new total, or the end of the analysis.
+type progressUpdate struct {
+	items    int
+	bytes    int64
+	total    int64
+	setTotal bool
+	finish   bool
+}
+
+// newProgress creates a progress display for total items. A negative total
+// starts a spinner.
+func newProgress(total int64) *progress {
+	p := &progress{
+		updates: make(chan progressUpdate, 256),
+		done:    make(chan struct{}),
+		bar:     newProgressBar(total),
+		start:   time.Now(),
+	}
+	go p.run()
+	return p
+}
+
+// newProgressBar mirrors progressbar.Default, counting files and predicting
+// the remaining time.
+func newProgressBar(total int64) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("files"),
+		progressbar.OptionSetPredictTime(true),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
+
+// run applies updates to the bar until the analysis finishes.
+func (p *progress) run() {
+	defer close(p.done)
+	for u := range p.updates {
+		switch {
+		case u.finish:
+			p.finish()
+			return
+		case u.setTotal:
+			p.bar.Clear()
+			p.bar = newProgressBar(u.total)
+			p.bar.Set64(p.current)
+			p.describe()
+		case u.bytes > 0:
+			p.bytes += u.bytes
+			p.describe()
+		default:
+			p.current += int64(u.items)
+			p.bar.Add(u.items)
+		}
+	}
+}
+
+// send hands u to the owning goroutine, dropping it once the bar finished.
+func (p *progress) send(u progressUpdate) {
+	select {
+	case p.updates <- u:
+	case <-p.done:
+	}
+}
+
+func (p *progress) Add(n int) {
+	p.send(progressUpdate{items: n})
+}
+
+// AddBytes records n bytes as processed and updates the throughput shown in
+// the bar's description.
+func (p *progress) AddBytes(n int64) {
+	p.send(progressUpdate{bytes: n})
+}
+
+func (p *progress) describe() {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	p.bar.Describe(fmt.Sprintf("%.1f MB/s", float64(p.bytes)/elapsed/1e6))
+}
+
+// SetTotal replaces a spinner with a bar of the given total, keeping the
+// progress made so far.
+func (p *progress) SetTotal(total int64) {
+	p.send(progressUpdate{total: total, setTotal: true})
+}
+
+// Finish completes the bar with the number of items actually processed,
+// which differs from the counted total when files are created or deleted
+// during the scan. It returns once the bar is rendered for the last time.
+func (p *progress) Finish() {
+	p.send(progressUpdate{finish: true})
+	<-p.done
+}
+
+func (p *progress) finish() {
+	if max := p.bar.GetMax64(); max < 0 || max == p.current {
+		return
+	}
+	p.bar.ChangeMax64(p.current)
+	p.bar.Finish()
+}
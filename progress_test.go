@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestProgressConcurrent reports progress from many goroutines at once; run
+// it with -race to check that only the owning goroutine touches the bar.
+func TestProgressConcurrent(t *testing.T) {
+	for _, total := range []int64{-1, 1000} {
+		p := newProgress(total)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					p.Add(1)
+					p.AddBytes(10)
+				}
+				if i == 5 {
+					p.SetTotal(1000)
+				}
+			}(i)
+		}
+		wg.Wait()
+		p.Finish()
+
+		if p.current != 1000 || p.bytes != 10000 {
+			t.Errorf("total %d: got %d items and %d bytes, want 1000 and 10000", total, p.current, p.bytes)
+		}
+		// Updates after Finish are dropped rather than blocking.
+		p.Add(1)
+	}
+}
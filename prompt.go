@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+const (
+	promptStyleRaw      = "raw"
+	promptStyleSections = "sections"
+)
+
+var (
+	promptStyle = promptStyleRaw
+	contextFile string
+	// collapseChains joins directories whose only child is another
+	// directory into one entry in the structure section and the skeleton.
+	collapseChains bool
+)
+
+// validatePromptStyle checks the value given to --prompt-style.
+func validatePromptStyle() error {
+	switch promptStyle {
+	case promptStyleRaw, promptStyleSections:
+		return nil
+	}
+	return fmt.Errorf("invalid prompt style %q, expected raw or sections", promptStyle)
+}
+
+// sectionedPrompt reports whether the output is split into system,
+// structure and files sections. Only the text-based formats are sectioned.
+func sectionedPrompt() bool {
+	return promptStyle == promptStyleSections && apptree.TextFramed(outputFormat)
+}
+
+// beginSection and endSection return the delimiters around a section.
+func beginSection(name string) string { return "<<<BEGIN " + name + ">>>\n" }
+func endSection(name string) string   { return "<<<END " + name + ">>>\n" }
+
+// writePromptPreamble writes the system section, holding --context-file,
+// the --git-context header and the --baseline comparison, and the structure
+// section listing the tree, then opens the files section.
+func writePromptPreamble(roots []string) error {
+	writeOutput(beginSection("SYSTEM"))
+	if contextFile != "" {
+		context, err := os.ReadFile(contextFile)
+		if err != nil {
+			return err
+		}
+		text := string(context)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		writeOutput(text)
+	}
+	if gitContext {
+		writeGitContext(roots)
+	}
+	if baselinePath != "" {
+		writeBaselineHeader()
+	}
+	writeOutput(endSection("SYSTEM"))
+
+	writeOutput(beginSection("STRUCTURE"))
+	for _, root := range roots {
+		writeOutput(displayPath(root) + "/\n")
+		writeStructure(root, "  ")
+	}
+	writeOutput(endSection("STRUCTURE"))
+
+	writeOutput(beginSection("FILES"))
+	return nil
+}
+
+// writePromptEnd closes the files section.
+func writePromptEnd() {
+	writeOutput(endSection("FILES"))
+}
+
+// writeStructure lists the entries under root that the traversal visits, one
+// per line and indented by depth, with directories marked by a trailing
+// slash. With --collapse-chains, a chain of directories each holding only
+// the next is listed as one entry, like src/main/java/.
+func writeStructure(root, indent string) {
+	tree, _ := apptree.AnalyzeContext(analysisCtx, rootOptions(root))
+	if tree != nil {
+		writeStructureNodes(tree.Children, indent)
+	}
+}
+
+func writeStructureNodes(nodes []*apptree.Node, indent string) {
+	for _, n := range nodes {
+		if n.Info == nil {
+			continue
+		}
+		name := n.Name
+		if !n.Dir {
+			writeOutput(indent + name + "\n")
+			continue
+		}
+
+		children := n.Children
+		for collapseChains && len(children) == 1 && children[0].Dir {
+			name += "/" + children[0].Name
+			children = children[0].Children
+		}
+		writeOutput(indent + name + "/\n")
+		writeStructureNodes(children, indent+"  ")
+	}
+}
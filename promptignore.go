@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	usePromptignore = true
+	// promptignoreRoots are the roots whose .promptignore files apply, or
+	// nil with --promptignore=false.
+	promptignoreRoots []string
+
+	promptignoreMu    sync.Mutex
+	promptignoreRules = map[string][]gitignoreRule{}
+)
+
+// promptignoreScope matches the "# only:" suffix limiting a .promptignore
+// entry to some output formats, as in "fixtures/ # only:text,html".
+var promptignoreScope = regexp.MustCompile(`\s+#\s*only:\s*([\w,\s]+)$`)
+
+// loadPromptignoreRoots enables the .promptignore files under roots.
+func loadPromptignoreRoots(roots []string) {
+	if usePromptignore {
+		promptignoreRoots = roots
+	}
+}
+
+// isPromptignored reports whether path is excluded from the current output
+// format by the .promptignore files in its root and the directories below.
+// They use the .gitignore syntax, and an entry ending in "# only:" and a
+// list of formats applies to those formats alone.
+func isPromptignored(path string, isDir bool) bool {
+	root := ""
+	for _, r := range promptignoreRoots {
+		if (path == r || strings.HasPrefix(path, r+string(filepath.Separator))) && len(r) > len(root) {
+			root = r
+		}
+	}
+	if root == "" || path == root {
+		return false
+	}
+	return matchesIgnoreRules(path, root, isDir, loadPromptignore)
+}
+
+// loadPromptignore returns the rules of dir/.promptignore that apply to the
+// current output format, reading it once.
+func loadPromptignore(dir string) []gitignoreRule {
+	promptignoreMu.Lock()
+	defer promptignoreMu.Unlock()
+	if rules, ok := promptignoreRules[dir]; ok {
+		return rules
+	}
+
+	rules := readIgnoreFile(filepath.Join(dir, ".promptignore"), parsePromptignoreLine)
+	promptignoreRules[dir] = rules
+	return rules
+}
+
+// parsePromptignoreLine parses one line of a .promptignore file, returning
+// ok=false for blank lines, comments and entries scoped to other formats.
+func parsePromptignoreLine(line string) (gitignoreRule, bool) {
+	m := promptignoreScope.FindStringSubmatchIndex(line)
+	if m == nil {
+		return parseGitignoreLine(line)
+	}
+
+	scoped := false
+	for _, format := range strings.Split(line[m[2]:m[3]], ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		scoped = scoped || format == outputFormat
+	}
+	if !scoped {
+		return gitignoreRule{}, false
+	}
+	return parseGitignoreLine(line[:m[0]])
+}
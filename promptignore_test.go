@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePromptignoreLineScope(t *testing.T) {
+	defer func(format string) { outputFormat = format }(outputFormat)
+
+	tests := []struct {
+		line, format string
+		want         bool
+	}{
+		{"main.go", formatText, true},
+		{"main.go # only:json", formatJSON, true},
+		{"main.go # only:json", formatJSONL, false},
+		{"main.go # only:jsonl", formatJSON, false},
+		{"main.go # only:jsonl", formatJSONL, true},
+		{"fixtures/ # only: text, html", formatHTML, true},
+		{"fixtures/ # only:text,html", formatMarkdown, false},
+	}
+	for _, tt := range tests {
+		outputFormat = tt.format
+		if _, ok := parsePromptignoreLine(tt.line); ok != tt.want {
+			t.Errorf("%q with --format %s applies = %v, want %v", tt.line, tt.format, ok, tt.want)
+		}
+	}
+}
+
+// TestPromptignoreOnlyJSON checks that an entry scoped to json leaves the
+// file out of the json tree and nowhere else.
+func TestPromptignoreOnlyJSON(t *testing.T) {
+	root := writeFixture(t)
+	if err := os.WriteFile(filepath.Join(root, ".promptignore"), []byte("main.go # only:json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := runApp(t, root, "--deterministic", "--no-precount", "--format", "json")
+	if got := readOutput(t, dir, "app_tree.json"); strings.Contains(got, `"main.go"`) {
+		t.Errorf("main.go is in the json output:\n%s", got)
+	}
+	for format, name := range map[string]string{formatJSONL: "app_tree.jsonl", formatText: "app_tree_prompt.txt"} {
+		dir, _ := runApp(t, root, "--deterministic", "--no-precount", "--format", format)
+		if got := readOutput(t, dir, name); !strings.Contains(got, "proj/main.go") {
+			t.Errorf("main.go is missing from the %s output:\n%s", format, got)
+		}
+	}
+}
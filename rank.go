@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// rankRule gives files matching pattern a rank; lower ranks are output
+// first. Patterns without a slash match the base name, others the path
+// relative to its root, with forward slashes.
+type rankRule struct {
+	pattern string
+	rank    int
+}
+
+// The ranks of the default rules.
+const (
+	rankEntrypoint = iota
+	rankConfig
+	rankTest
+	rankOther
+)
+
+// defaultRankRules puts entrypoints and READMEs first, then build and
+// configuration files, then tests, then everything else. The first matching
+// rule wins, so tests are matched before the config extensions.
+var defaultRankRules = []rankRule{
+	{"README*", rankEntrypoint},
+	{"main.go", rankEntrypoint},
+	{"main.py", rankEntrypoint},
+	{"__main__.py", rankEntrypoint},
+	{"app.py", rankEntrypoint},
+	{"manage.py", rankEntrypoint},
+	{"main.rs", rankEntrypoint},
+	{"lib.rs", rankEntrypoint},
+	{"index.js", rankEntrypoint},
+	{"index.ts", rankEntrypoint},
+	{"server.js", rankEntrypoint},
+	{"app.js", rankEntrypoint},
+	{"Main.java", rankEntrypoint},
+
+	{"*_test.go", rankTest},
+	{"test_*.py", rankTest},
+	{"*_test.py", rankTest},
+	{"*.test.js", rankTest},
+	{"*.spec.js", rankTest},
+	{"*.test.ts", rankTest},
+	{"*.spec.ts", rankTest},
+	{"*Test.java", rankTest},
+
+	{"go.mod", rankConfig},
+	{"package.json", rankConfig},
+	{"Cargo.toml", rankConfig},
+	{"pyproject.toml", rankConfig},
+	{"requirements.txt", rankConfig},
+	{"pom.xml", rankConfig},
+	{"Makefile", rankConfig},
+	{"Dockerfile", rankConfig},
+	{".env*", rankConfig},
+	{"*.json", rankConfig},
+	{"*.yaml", rankConfig},
+	{"*.yml", rankConfig},
+	{"*.toml", rankConfig},
+	{"*.ini", rankConfig},
+}
+
+var (
+	rankFiles     bool
+	rankRuleFlags []string
+	// rankRules are the --rank-rule values followed by the defaults.
+	rankRules = defaultRankRules
+)
+
+// parseRankRules parses --rank-rule values of the form pattern=rank and
+// puts them ahead of the default rules, so they take precedence.
+func parseRankRules(values []string) ([]rankRule, error) {
+	var rules []rankRule
+	for _, value := range values {
+		pattern, rank, ok := strings.Cut(value, "=")
+		pattern, rank = strings.TrimSpace(pattern), strings.TrimSpace(rank)
+		if !ok || pattern == "" || rank == "" {
+			return nil, fmt.Errorf("invalid rank rule %q, expected pattern=rank", value)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in rank rule %q: %v", value, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in rank rule %q: %v", value, err)
+		}
+		rules = append(rules, rankRule{pattern: pattern, rank: n})
+	}
+	return append(rules, defaultRankRules...), nil
+}
+
+// fileRank returns the rank of the first rule matching rel, a path relative
+// to its root with forward slashes, or rankOther when none does.
+func fileRank(rel string) int {
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, r := range rankRules {
+		subject := name
+		if strings.Contains(r.pattern, "/") {
+			subject = rel
+		}
+		if matched, _ := filepath.Match(r.pattern, subject); matched {
+			return r.rank
+		}
+	}
+	return rankOther
+}
+
+// renderRankedFiles outputs the files under roots ordered by --rank across
+// the whole tree, without directory headers, or only the first --top of
+// them. Files of the same rank keep the traversal order.
+func renderRankedFiles(roots []string) {
+	type ranked struct {
+		apptree.Entry
+		rank int
+	}
+	var files []ranked
+	for _, root := range roots {
+		var entries []apptree.Entry
+		collectFiles(root, &entries)
+		for _, e := range entries {
+			rel, err := filepath.Rel(root, e.Path)
+			if err != nil {
+				rel = e.Name
+			}
+			files = append(files, ranked{e, fileRank(filepath.ToSlash(rel))})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].rank < files[j].rank
+	})
+	if topFiles > 0 && len(files) > topFiles {
+		files = files[:topFiles]
+	}
+
+	for _, f := range files {
+		if analysisStopped() {
+			break
+		}
+		processFile(f.Entry)
+	}
+}
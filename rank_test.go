@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFileRank(t *testing.T) {
+	defer func(rules []rankRule) { rankRules = rules }(rankRules)
+
+	var err error
+	rankRules, err = parseRankRules([]string{"cmd/*/main.go=5", "*.proto=-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"main.go", rankEntrypoint},
+		{"README.md", rankEntrypoint},
+		{"go.mod", rankConfig},
+		{"config/app.json", rankConfig},
+		{"internal/util/util_test.go", rankTest},
+		{"internal/util/util.go", rankOther},
+		{"cmd/tool/main.go", 5},
+		{"api/service.proto", -1},
+	}
+	for _, tt := range tests {
+		if got := fileRank(tt.path); got != tt.want {
+			t.Errorf("fileRank(%q) is %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRankRulesInvalid(t *testing.T) {
+	for _, value := range []string{"main.go", "=1", "main.go=first", "[=1"} {
+		if _, err := parseRankRules([]string{value}); err == nil {
+			t.Errorf("parseRankRules(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var resume bool
+
+// checkpointSuffix is appended to the output file name to name the
+// checkpoint --resume keeps while the analysis runs.
+const checkpointSuffix = ".checkpoint.json"
+
+// checkpointInterval is how often the checkpoint is written during the
+// traversal, bounding the work redone after a crash.
+const checkpointInterval = 5 * time.Second
+
+// checkpointFile is the on-disk form of a checkpoint. Offset is the length
+// of the output holding exactly the entries in Done.
+type checkpointFile struct {
+	Key    string   `json:"key"`
+	Offset int64    `json:"offset"`
+	Done   []string `json:"done"`
+	// Renderer is the state of a renderer whose output depends on what it
+	// wrote before, at Offset.
+	Renderer json.RawMessage `json:"renderer,omitempty"`
+}
+
+// analysisCheckpoint records which directories and files have been written
+// to the output, so an interrupted run can continue where it stopped. A nil
+// checkpoint is valid and records nothing.
+type analysisCheckpoint struct {
+	path    string
+	key     string
+	mu      sync.Mutex
+	resumed map[string]bool
+	done    []string
+	offset  int64
+	saved   time.Time
+	// renderer is the renderer of the output when its state is kept, and
+	// state that state at offset. restored is the state the interrupted
+	// run saved.
+	renderer apptree.ResumableRenderer
+	state    interface{}
+	restored json.RawMessage
+}
+
+var checkpoint *analysisCheckpoint
+
+// openCheckpoint loads the checkpoint kept next to output. A checkpoint left
+// by a run with other roots or flags is an error rather than silently
+// producing a mix of both.
+func openCheckpoint(output, root string, args []string) (*analysisCheckpoint, error) {
+	c := &analysisCheckpoint{
+		path:    output + checkpointSuffix,
+		key:     cacheKey(root, args),
+		resumed: map[string]bool{},
+		saved:   time.Now(),
+	}
+
+	data, err := ioutil.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", c.path, err)
+	}
+	if f.Key != c.key {
+		return nil, fmt.Errorf("%s was written for other roots or flags; remove it to start over", c.path)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < f.Offset {
+		return nil, fmt.Errorf("%s is shorter than its checkpoint; remove %s to start over", output, c.path)
+	}
+
+	c.done, c.offset, c.restored = f.Done, f.Offset, f.Renderer
+	for _, key := range f.Done {
+		c.resumed[key] = true
+	}
+	return c, nil
+}
+
+// resuming reports whether the output already holds entries from an
+// interrupted run, so it is continued rather than started over.
+func (c *analysisCheckpoint) resuming() bool {
+	return c != nil && len(c.resumed) > 0
+}
+
+// resumedOffset returns the length of the output to continue from.
+func (c *analysisCheckpoint) resumedOffset() int64 {
+	if !c.resuming() {
+		return 0
+	}
+	return c.offset
+}
+
+// wasDone reports whether key was written by the interrupted run.
+func (c *analysisCheckpoint) wasDone(key string) bool {
+	return c != nil && c.resumed[key]
+}
+
+// markDone records that everything for key has been written to the output,
+// saving the checkpoint when it is due.
+func (c *analysisCheckpoint) markDone(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = append(c.done, key)
+	c.offset = outputOffset()
+	if c.renderer != nil {
+		c.state = c.renderer.State()
+	}
+	if time.Since(c.saved) >= checkpointInterval {
+		c.saveLocked()
+	}
+}
+
+// keepState saves the state of r along with the checkpoint, restoring the
+// state the interrupted run saved when resuming, so r continues its output
+// as if it had written all of it.
+func (c *analysisCheckpoint) keepState(r apptree.StreamRenderer) error {
+	rr, ok := r.(apptree.ResumableRenderer)
+	if c == nil || !ok {
+		return nil
+	}
+	if c.resuming() && c.restored != nil {
+		if err := rr.Restore(c.restored); err != nil {
+			return fmt.Errorf("restoring the %s renderer from %s: %w", outputFormat, c.path, err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renderer, c.state = rr, rr.State()
+	return nil
+}
+
+// checkpointRenderer records the directory headers and notes r writes in
+// the checkpoint, and leaves out those the interrupted run already wrote.
+// Files are recorded by the traversal, and the entries of archives are
+// written again along with their archive.
+type checkpointRenderer struct {
+	apptree.StreamRenderer
+}
+
+func (c checkpointRenderer) Dir(w io.Writer, dir apptree.Entry) error {
+	return c.once(dir.Path, func() error { return c.StreamRenderer.Dir(w, dir) })
+}
+
+func (c checkpointRenderer) Note(w io.Writer, n apptree.Note) error {
+	if n.Kind != apptree.NoteMore {
+		return c.StreamRenderer.Note(w, n)
+	}
+	return c.once("more:"+n.Path, func() error { return c.StreamRenderer.Note(w, n) })
+}
+
+// once calls write unless the interrupted run wrote key, then records key.
+func (c checkpointRenderer) once(key string, write func() error) error {
+	if strings.Contains(key, archiveSeparator) {
+		return write()
+	}
+	if checkpoint.wasDone(key) {
+		return nil
+	}
+	defer checkpoint.markDone(key)
+	return write()
+}
+
+// save flushes the output and writes the checkpoint.
+func (c *analysisCheckpoint) save() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saveLocked()
+}
+
+func (c *analysisCheckpoint) saveLocked() {
+	c.saved = time.Now()
+	// The output must hold at least offset bytes before the checkpoint
+	// refers to them; anything written past it is dropped on resume.
+	if err := flushOutput(); err != nil {
+		return
+	}
+	f := checkpointFile{Key: c.key, Offset: c.offset, Done: c.done}
+	if c.renderer != nil {
+		state, err := json.Marshal(c.state)
+		if err != nil {
+			return
+		}
+		f.Renderer = state
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, c.path)
+}
+
+// remove deletes the checkpoint once the output is complete.
+func (c *analysisCheckpoint) remove() {
+	if c == nil {
+		return
+	}
+	os.Remove(c.path)
+}
+
+// saveCheckpointOnInterrupt saves the checkpoint and exits when the process
+// is interrupted, so the next --resume run continues from there.
+func saveCheckpointOnInterrupt() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		<-ch
+		checkpoint.save()
+		fmt.Printf("\nInterrupted. Run again with --resume to continue from %s.\n", checkpoint.path)
+		os.Exit(130)
+	}()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResumeHTML interrupts an html run and resumes it, checking that the
+// page is the one an uninterrupted run writes: file anchors continue where
+// the interrupted run stopped and the legend counts every file.
+func TestResumeHTML(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupting a process needs signals")
+	}
+	root := filepath.Join(t.TempDir(), "proj")
+	for i := 0; i < 40; i++ {
+		name := filepath.Join(root, fmt.Sprintf("d%d", i/10), fmt.Sprintf("f%02d%s", i, []string{".txt", ".go", ".md", ".json"}[i%4]))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("file %d\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Filtering every file through a slow command leaves time to interrupt
+	// the run halfway.
+	command := func(outDir string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], root, "--deterministic", "--no-precount", "--format", "html", "--resume", "--filter-cmd", "sleep 0.05; cat", "--output-dir", outDir)
+		cmd.Env = append(os.Environ(), runMainEnv+"=1")
+		return cmd
+	}
+
+	fullDir := t.TempDir()
+	if out, err := command(fullDir).CombinedOutput(); err != nil {
+		t.Fatalf("app-tree: %v\n%s", err, out)
+	}
+	want := readOutput(t, fullDir, "app_tree.html")
+
+	outDir := t.TempDir()
+	cmd := command(outDir)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	cmd.Process.Signal(os.Interrupt)
+	cmd.Wait()
+	if _, err := os.Stat(filepath.Join(outDir, "app_tree.html"+checkpointSuffix)); err != nil {
+		t.Skipf("the run wasn't interrupted halfway: %v", err)
+	}
+
+	out, err := command(outDir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("app-tree --resume: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "Resuming after") {
+		t.Fatalf("the second run didn't resume:\n%s", out)
+	}
+	if got := readOutput(t, outDir, "app_tree.html"); got != want {
+		t.Errorf("resumed page differs from an uninterrupted run\n%s", diffLines(want, got))
+	}
+}
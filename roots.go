@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandRoots resolves the directory arguments into absolute root
+// directories, expanding glob patterns like 'services/*' to every matching
+// directory. Without arguments the current directory is analyzed.
+func expandRoots(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	var roots []string
+	seen := map[string]bool{}
+	add := func(dir string) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			roots = append(roots, abs)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			if err := add(arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		found := false
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+			found = true
+			if err := add(match); err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no directories match %q", arg)
+		}
+	}
+	return roots, nil
+}
+
+// countRoots returns the total number of items under all roots.
+func countRoots(roots []string) int {
+	total := 0
+	for _, root := range roots {
+		total += countItems(root)
+	}
+	return total
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// ruleAction is the outcome of evaluating --rule-file for a file.
+type ruleAction string
+
+const (
+	ruleInclude ruleAction = "include"
+	ruleExclude ruleAction = "exclude"
+	// ruleHeader keeps the file's header but leaves out its content.
+	ruleHeader ruleAction = "header"
+)
+
+var (
+	ruleFile string
+	// fileRule is the compiled --rule-file expression, or nil without one,
+	// and ruleSource its source, which the cache key covers.
+	fileRule   cel.Program
+	ruleSource string
+	// ruleRoots are used to give rules paths relative to their root.
+	ruleRoots []string
+
+	ruleMu      sync.Mutex
+	ruleActions = map[string]ruleAction{}
+)
+
+// loadRuleFile compiles the CEL expression in path. The expression sees the
+// variables path (relative to its root, with forward slashes), name, ext,
+// size and mime, and returns a bool to include or exclude the file, or one
+// of "include", "exclude" and "header". CEL has no side effects or I/O, so
+// rules can't do anything but decide.
+func loadRuleFile(path string, roots []string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("path", cel.StringType),
+		cel.Variable("name", cel.StringType),
+		cel.Variable("ext", cel.StringType),
+		cel.Variable("size", cel.IntType),
+		cel.Variable("mime", cel.StringType),
+	)
+	if err != nil {
+		return err
+	}
+	ast, issues := env.Compile(string(source))
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("compiling %s: %w", path, issues.Err())
+	}
+	if t := ast.OutputType(); t != cel.BoolType && t != cel.StringType && t != cel.DynType {
+		return fmt.Errorf("%s must evaluate to a bool or a string, not %s", path, t)
+	}
+	prg, err := env.Program(ast, cel.CostLimit(100000))
+	if err != nil {
+		return err
+	}
+
+	fileRule = prg
+	ruleSource = string(source)
+	ruleRoots = roots
+	return nil
+}
+
+// evaluateRule returns the action --rule-file picks for the file at path.
+// Errors are logged and include the file.
+func evaluateRule(path string, info os.FileInfo) ruleAction {
+	if fileRule == nil {
+		return ruleInclude
+	}
+
+	rel := path
+	for _, root := range ruleRoots {
+		if r, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+			break
+		}
+	}
+	vars := map[string]interface{}{
+		"path": filepath.ToSlash(rel),
+		"name": filepath.Base(path),
+		"ext":  strings.ToLower(filepath.Ext(path)),
+		"size": info.Size(),
+		// Detecting the type reads the file, so only do it when asked.
+		"mime": func() interface{} { return detectPathType(path) },
+	}
+
+	out, _, err := fileRule.Eval(vars)
+	if err != nil {
+		slog.Warn("Error evaluating rule", "path", path, "err", err)
+		return ruleInclude
+	}
+	switch v := out.Value().(type) {
+	case bool:
+		if v {
+			return ruleInclude
+		}
+		return ruleExclude
+	case string:
+		switch action := ruleAction(v); action {
+		case ruleInclude, ruleExclude, ruleHeader:
+			return action
+		}
+	}
+	slog.Warn("Rule returned an unknown action", "path", path, "value", out.Value())
+	return ruleInclude
+}
+
+// ruleActionFor returns the action for path, evaluating the rule once and
+// remembering the result for later stages of the analysis.
+func ruleActionFor(path string, info os.FileInfo) ruleAction {
+	if fileRule == nil {
+		return ruleInclude
+	}
+	ruleMu.Lock()
+	action, ok := ruleActions[path]
+	ruleMu.Unlock()
+	if ok {
+		return action
+	}
+
+	action = evaluateRule(path, info)
+	ruleMu.Lock()
+	ruleActions[path] = action
+	ruleMu.Unlock()
+	return action
+}
+
+// headerOnlyByRule reports whether the rule asked for file's content to be
+// left out. Files the rule never saw, such as archive entries, are kept.
+func headerOnlyByRule(file string) bool {
+	ruleMu.Lock()
+	defer ruleMu.Unlock()
+	return ruleActions[file] == ruleHeader
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	sampleSize int
+	sampleSeed int64 = 1
+	// samplePaths holds the files picked by --sample together with their
+	// ancestor directories, or nil when not sampling.
+	samplePaths map[string]bool
+	// sampleTotal is the number of files sampling chose from.
+	sampleTotal int
+)
+
+// selectSample picks --sample files at random from those the analysis of
+// roots would include, using --seed so the same tree gives the same sample.
+// Pinned files are always kept in addition to the sample.
+func selectSample(roots []string) {
+	type candidate struct {
+		apptree.Entry
+		root string
+	}
+	var candidates []candidate
+	for _, root := range roots {
+		var files []apptree.Entry
+		collectFiles(root, &files)
+		for _, f := range files {
+			candidates = append(candidates, candidate{f, root})
+		}
+	}
+	sampleTotal = len(candidates)
+
+	// collectFiles lists files in a fixed order, so the shuffle depends only
+	// on the tree and the seed.
+	rng := rand.New(rand.NewSource(sampleSeed))
+	rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	samplePaths = map[string]bool{}
+	picked := 0
+	for _, c := range candidates {
+		if picked < sampleSize {
+			picked++
+		} else if !isPinned(c.Path) {
+			continue
+		}
+		addWithAncestors(samplePaths, c.root, c.Path)
+	}
+}
+
+// sampleSkipped returns the number of files left out by --sample.
+func sampleSkipped() int {
+	return max(sampleTotal-sampleSize, 0)
+}
+
+// writeSampleNote notes at the end of the output that it holds a sample.
+func writeSampleNote() {
+	if sampleSkipped() == 0 {
+		return
+	}
+	writeNote(apptree.Note{
+		Kind:    apptree.NoteText,
+		Text:    fmt.Sprintf("\n[Sampled %d of %d files with seed %d; %d skipped]\n", sampleSize, sampleTotal, sampleSeed, sampleSkipped()),
+		Records: []jsonlRecord{{Kind: "sampled", Omitted: sampleSkipped()}},
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+)
+
+var (
+	auditSecrets bool
+	// strict makes --audit-secrets exit with status 1 when it finds any.
+	strict bool
+)
+
+// secretPattern is a kind of credential --audit-secrets looks for.
+type secretPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// secretPatterns match likely credentials. They favor precision, since a
+// report full of false positives is ignored.
+var secretPatterns = []secretPattern{
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[0-9A-Za-z]{36}|github_pat_[0-9A-Za-z_]{82})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[0-9A-Za-z_-]{10,}\.eyJ[0-9A-Za-z_-]{10,}\.[0-9A-Za-z_-]{10,}`)},
+	{"credential assignment", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|password|passwd|token|access[_-]?key)\b["']?\s*[:=]\s*["'][^"'\s]{8,}["']`)},
+}
+
+// runAuditSecrets walks roots applying the analysis filters and prints the
+// file, line and kind of every likely secret in text files, never the
+// secret itself. It reports whether any were found.
+func runAuditSecrets(roots []string) bool {
+	found := 0
+	for _, root := range roots {
+		walkRoot(root, func(path string, info os.FileInfo, err error) {
+			if err != nil {
+				slog.Error("Error accessing path", "path", path, "err", err)
+				return
+			}
+			if info.IsDir() {
+				return
+			}
+			if !info.Mode().IsRegular() || !isText(detectPathType(path)) {
+				return
+			}
+
+			content, release, err := readFileContent(path)
+			if err != nil {
+				slog.Error("Error reading file", "path", path, "err", err)
+				return
+			}
+			defer release()
+			n := 0
+			forEachLine(content, func(line []byte) {
+				n++
+				for _, p := range secretPatterns {
+					if p.re.Match(line) {
+						fmt.Printf("%s:%d: possible %s\n", displayPath(path), n, p.name)
+						found++
+						break
+					}
+				}
+			})
+		})
+	}
+
+	if found == 0 {
+		fmt.Println("No likely secrets found.")
+	} else {
+		fmt.Printf("\nFound %d likely secrets.\n", found)
+	}
+	return found > 0
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveHost = "localhost"
+	servePort int
+	serveAuth string
+)
+
+func newServeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve [output-file]",
+		Short: "Serve a previously generated output file in the browser",
+		Long:  `serve starts a local web server for an existing app-tree output (text, JSON or HTML) without re-walking the filesystem.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := serveResult(args[0]); err != nil {
+				slog.Error("Error serving output", "path", args[0], "err", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// serveResult serves the output file at path until the process is interrupted.
+// With --watch the file is read again for every request, as it is rebuilt
+// when the tree changes, and pages reload through /events.
+func serveResult(path string) error {
+	return servePage(filepath.Base(path), func() ([]byte, string, error) {
+		return loadServedPage(path)
+	})
+}
+
+// serveContent serves output named name that was generated in memory with
+// --no-temp-file, until the process is interrupted.
+func serveContent(name string, data []byte) error {
+	page, contentType, err := renderServedData(name, data)
+	if err != nil {
+		return err
+	}
+	return servePage(name, func() ([]byte, string, error) {
+		return page, contentType, nil
+	})
+}
+
+// servePage serves the page load returns, calling it again for every
+// request under --watch.
+func servePage(name string, load func() ([]byte, string, error)) error {
+	page, contentType, err := load()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		page, contentType := page, contentType
+		if reloads != nil {
+			var err error
+			if page, contentType, err = load(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(page)
+	})
+	if reloads != nil {
+		mux.Handle("/events", reloads)
+	}
+
+	var handler http.Handler = mux
+	if serveAuth != "" {
+		user, pass, ok := strings.Cut(serveAuth, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("invalid --auth value, expected user:pass")
+		}
+		handler = basicAuth(handler, user, pass)
+	}
+
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	if !isLoopbackHost(serveHost) && serveAuth == "" {
+		slog.Warn("Serving beyond localhost without --auth; anyone who can reach the host can read the output", "host", serveHost)
+	}
+
+	server := &http.Server{
+		Addr:      net.JoinHostPort(serveHost, strconv.Itoa(servePort)),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	go func() {
+		if tlsConfig != nil {
+			errCh <- server.ListenAndServeTLS("", "")
+		} else {
+			errCh <- server.ListenAndServe()
+		}
+	}()
+
+	fmt.Printf("Serving %s at %s://%s (press Ctrl+C to stop)\n", name, scheme, server.Addr)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Debug("Shutting down server")
+	return server.Shutdown(context.Background())
+}
+
+// isLoopbackHost reports whether host only accepts connections from the
+// local machine.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loadServedPage reads the output file at path and returns the page to
+// serve for it with its content type.
+func loadServedPage(path string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return renderServedData(path, data)
+}
+
+// renderServedData returns the page to serve for the output data named
+// path with its content type.
+func renderServedData(path string, data []byte) ([]byte, string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return data, "application/pdf", nil
+	}
+	page, err := renderServedPage(path, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if reloads != nil {
+		page = injectLiveReload(page)
+	}
+	return page, "text/html; charset=utf-8", nil
+}
+
+// renderServedPage turns a text, JSON or HTML output into an HTML page.
+func renderServedPage(path string, data []byte) ([]byte, error) {
+	switch {
+	case strings.EqualFold(filepath.Ext(path), ".html"):
+		return data, nil
+	case json.Valid(data):
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return nil, err
+		}
+		return []byte(apptree.HTMLPage(indented.String())), nil
+	default:
+		return []byte(apptree.HTMLPage(string(data))), nil
+	}
+}
+
+// basicAuth wraps next so that requests must carry the given credentials.
+func basicAuth(next http.Handler, user, pass string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="app-tree", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
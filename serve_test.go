@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestIsLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost": true,
+		"127.0.0.1": true,
+		"::1":       true,
+		"0.0.0.0":   false,
+		"10.0.0.5":  false,
+		"devbox":    false,
+	} {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+// TestSelfSignedCertHost checks that the generated certificate is valid
+// for --host, so clients on other machines can verify it.
+func TestSelfSignedCertHost(t *testing.T) {
+	defer func(host string) { serveHost = host }(serveHost)
+
+	for _, host := range []string{"10.0.0.5", "devbox.local"} {
+		serveHost = host
+		cert, err := selfSignedCert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parsed.VerifyHostname(host); err != nil {
+			t.Errorf("certificate for --host %s: %v", host, err)
+		}
+		if err := parsed.VerifyHostname("localhost"); err != nil {
+			t.Errorf("certificate for --host %s no longer covers localhost: %v", host, err)
+		}
+	}
+}
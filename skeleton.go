@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// skeletonNode is a file or directory in the --format skeleton output.
+// Files are encoded as their name and directories as an object holding
+// their name and children. The size of files is kept for --format dot.
+type skeletonNode struct {
+	name     string
+	dir      bool
+	size     int64
+	children []*skeletonNode
+}
+
+func (n *skeletonNode) MarshalJSON() ([]byte, error) {
+	if !n.dir {
+		return json.Marshal(n.name)
+	}
+	children := n.children
+	if children == nil {
+		children = []*skeletonNode{}
+	}
+	return json.Marshal(struct {
+		Name     string          `json:"name"`
+		Children []*skeletonNode `json:"children"`
+	}{n.name, children})
+}
+
+var (
+	skeletonMu    sync.Mutex
+	skeletonRoots []*skeletonNode
+	// skeletonDirs indexes the directory nodes by path, with archives keyed
+	// without their trailing separator.
+	skeletonDirs = map[string]*skeletonNode{}
+)
+
+func init() {
+	apptree.RegisterStream(formatSkeleton, func(apptree.Framing) apptree.StreamRenderer { return skeletonRenderer{renderSkeleton} })
+	apptree.RegisterStream(formatDot, func(apptree.Framing) apptree.StreamRenderer { return skeletonRenderer{renderDot} })
+}
+
+// skeletonRenderer records the directories and files of the output, and
+// writes the tree they form with render at its end.
+type skeletonRenderer struct {
+	render func() string
+}
+
+func (s skeletonRenderer) Begin(w io.Writer) error {
+	resetSkeleton()
+	return nil
+}
+
+func (s skeletonRenderer) End(w io.Writer) error {
+	_, err := io.WriteString(w, s.render())
+	return err
+}
+
+func (s skeletonRenderer) Dir(w io.Writer, dir apptree.Entry) error {
+	addSkeletonDir(dir.Path)
+	return nil
+}
+
+func (s skeletonRenderer) File(w io.Writer, f apptree.File) error {
+	addSkeletonFile(f.Path, f.Size)
+	return nil
+}
+
+func (s skeletonRenderer) Note(w io.Writer, n apptree.Note) error { return nil }
+
+// skeletonParent returns the node of the nearest recorded directory above
+// path along with path's name relative to it.
+func skeletonParent(path string) (*skeletonNode, string) {
+	for p := path; ; {
+		i := strings.LastIndexAny(p, `/\`)
+		if i <= 0 {
+			return nil, ""
+		}
+		p = p[:i]
+		if parent, ok := skeletonDirs[p]; ok {
+			return parent, path[i+1:]
+		}
+		if parent, ok := skeletonDirs[strings.TrimSuffix(p, "!")]; ok {
+			return parent, path[i+1:]
+		}
+	}
+}
+
+func addSkeletonNode(path string, dir bool, size int64) {
+	skeletonMu.Lock()
+	defer skeletonMu.Unlock()
+
+	key := strings.TrimSuffix(path, archiveSeparator)
+	node := &skeletonNode{dir: dir, size: size}
+	if parent, name := skeletonParent(key); parent != nil {
+		node.name = name
+		parent.children = append(parent.children, node)
+	} else {
+		node.name = filepath.Base(key)
+		skeletonRoots = append(skeletonRoots, node)
+	}
+	if dir {
+		skeletonDirs[key] = node
+	}
+}
+
+// addSkeletonDir records a directory, or an archive opened as one.
+func addSkeletonDir(dir string) {
+	addSkeletonNode(dir, true, 0)
+}
+
+func addSkeletonFile(file string, size int64) {
+	addSkeletonNode(file, false, size)
+}
+
+// resetSkeleton forgets the tree of the previous skeleton output.
+func resetSkeleton() {
+	skeletonMu.Lock()
+	defer skeletonMu.Unlock()
+	skeletonRoots = nil
+	skeletonDirs = map[string]*skeletonNode{}
+}
+
+// renderSkeleton returns the JSON array of the recorded roots.
+func renderSkeleton() string {
+	roots := skeletonTree()
+	if roots == nil {
+		roots = []*skeletonNode{}
+	}
+	data, err := json.Marshal(roots)
+	if err != nil {
+		slog.Error("Error encoding skeleton", "err", err)
+		return ""
+	}
+	return string(data) + "\n"
+}
+
+// skeletonTree returns the recorded roots, with the chains below them
+// collapsed under --collapse-chains.
+func skeletonTree() []*skeletonNode {
+	skeletonMu.Lock()
+	defer skeletonMu.Unlock()
+
+	if !collapseChains {
+		return skeletonRoots
+	}
+	collapsed := make([]*skeletonNode, len(skeletonRoots))
+	for i, root := range skeletonRoots {
+		c := *root
+		c.children = collapseSkeletonChains(root.children)
+		collapsed[i] = &c
+	}
+	return collapsed
+}
+
+// collapseSkeletonChains returns copies of nodes in which every directory
+// whose only child is another directory is merged with it, joining their
+// names with a slash.
+func collapseSkeletonChains(nodes []*skeletonNode) []*skeletonNode {
+	collapsed := make([]*skeletonNode, len(nodes))
+	for i, n := range nodes {
+		c := *n
+		for c.dir && len(c.children) == 1 && c.children[0].dir {
+			c.name += "/" + c.children[0].name
+			c.children = c.children[0].children
+		}
+		if c.dir {
+			c.children = collapseSkeletonChains(c.children)
+		}
+		collapsed[i] = &c
+	}
+	return collapsed
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// projectType describes how to recognize a kind of project and which of its
+// directories hold build output or dependencies rather than source.
+type projectType struct {
+	name        string
+	markers     []string
+	excludeDirs []string
+}
+
+// projectTypes is the table --smart detects projects with. Add an entry to
+// support another stack.
+var projectTypes = []projectType{
+	{name: "go", markers: []string{"go.mod"}, excludeDirs: []string{"vendor", "bin"}},
+	{name: "node", markers: []string{"package.json"}, excludeDirs: []string{"node_modules", "dist", "build", "coverage", ".next", ".nuxt"}},
+	{name: "python", markers: []string{"pyproject.toml", "setup.py", "requirements.txt"}, excludeDirs: []string{"__pycache__", ".venv", "venv", ".tox", ".pytest_cache", ".mypy_cache", "build", "dist"}},
+	{name: "rust", markers: []string{"Cargo.toml"}, excludeDirs: []string{"target"}},
+	{name: "java", markers: []string{"pom.xml", "build.gradle", "build.gradle.kts"}, excludeDirs: []string{"target", "build", ".gradle"}},
+}
+
+// smartCommonExcludes are skipped by --smart for every project type.
+var smartCommonExcludes = []string{".git", ".hg", ".svn", ".idea", ".vscode"}
+
+var (
+	smartDefaults bool
+	// forcedProjectTypes overrides detection with --project-type.
+	forcedProjectTypes []string
+	// smartExcludeDirs holds the directory names skipped by --smart.
+	smartExcludeDirs map[string]bool
+)
+
+// applySmartDefaults detects the project type of each root, or uses
+// --project-type, and skips the directories those types exclude.
+func applySmartDefaults(roots []string) error {
+	var types []projectType
+	if len(forcedProjectTypes) > 0 {
+		for _, name := range forcedProjectTypes {
+			t, ok := findProjectType(name)
+			if !ok {
+				return fmt.Errorf("unknown project type %q", name)
+			}
+			types = append(types, t)
+		}
+	} else {
+		for _, root := range roots {
+			types = append(types, detectProjectTypes(root)...)
+		}
+	}
+
+	smartExcludeDirs = map[string]bool{}
+	for _, name := range smartCommonExcludes {
+		smartExcludeDirs[name] = true
+	}
+	for _, t := range types {
+		slog.Info("Applying project defaults", "type", t.name)
+		for _, name := range t.excludeDirs {
+			smartExcludeDirs[name] = true
+		}
+	}
+	return nil
+}
+
+// detectProjectTypes returns the project types whose marker files exist in
+// root.
+func detectProjectTypes(root string) []projectType {
+	var types []projectType
+	for _, t := range projectTypes {
+		for _, marker := range t.markers {
+			if _, err := os.Stat(filepath.Join(root, marker)); err == nil {
+				types = append(types, t)
+				break
+			}
+		}
+	}
+	return types
+}
+
+func findProjectType(name string) (projectType, bool) {
+	for _, t := range projectTypes {
+		if strings.EqualFold(t.name, name) {
+			return t, true
+		}
+	}
+	return projectType{}, false
+}
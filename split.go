@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	outputDirectory string
+	splitByDir      bool
+)
+
+// outputUnit is an output file and the traversal that fills it. roots are
+// the directories its preamble describes.
+type outputUnit struct {
+	path  string
+	roots []string
+	write func()
+}
+
+// writeOutputUnit writes the output of unit from preamble to close.
+func writeOutputUnit(unit outputUnit) error {
+	closeOutput, err := openOutput(unit.path)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+
+	if checkpoint.resuming() {
+		// The preamble is part of the output being continued.
+	} else if sectionedPrompt() {
+		if err := writePromptPreamble(unit.roots); err != nil {
+			closeOutput()
+			return fmt.Errorf("reading context file: %w", err)
+		}
+	} else if !isTreeFormat() {
+		if gitContext {
+			writeGitContext(unit.roots)
+		}
+		if baselinePath != "" {
+			writeBaselineHeader()
+		}
+	}
+
+	unit.write()
+
+	if sectionedPrompt() {
+		writePromptEnd()
+	}
+	slog.Debug("Finished traversing directory")
+	return closeOutput()
+}
+
+// splitOutputUnits returns an output for every top-level directory of
+// roots, named after the directory with the extension ext, and one named
+// after its root for the files directly inside each root.
+func splitOutputUnits(roots []string, dir, ext string) []outputUnit {
+	var units []outputUnit
+	used := map[string]bool{}
+	add := func(name string, unitRoots []string, write func()) {
+		path := filepath.Join(dir, name+ext)
+		for i := 2; used[path]; i++ {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, ext))
+		}
+		used[path] = true
+		units = append(units, outputUnit{path: path, roots: unitRoots, write: write})
+	}
+
+	for _, root := range roots {
+		opts := rootOptions(root)
+		opts.MaxDepth = 1
+		tree, err := apptree.AnalyzeContext(analysisCtx, opts)
+		if tree == nil || tree.Err != nil {
+			if err == nil {
+				err = tree.Err
+			}
+			slog.Error("Error reading directory", "path", root, "err", err)
+			continue
+		}
+
+		var files []apptree.Entry
+		for _, n := range tree.Children {
+			if n.Info == nil {
+				continue
+			}
+			if !n.Dir {
+				files = append(files, n.Entry())
+				continue
+			}
+			path := n.Path
+			add(n.Name, []string{path}, func() {
+				bar := newAnalysisProgress([]string{path})
+				traverseDirectory(path, bar)
+				writeSizeHistogram()
+				writePartialNote()
+				bar.Finish()
+			})
+		}
+
+		if len(files) > 0 {
+			add(filepath.Base(root), []string{root}, func() {
+				for _, f := range files {
+					processFile(f)
+				}
+				writeSizeHistogram()
+			})
+		}
+	}
+	return units
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// largestFilesCount is how many of the largest files the statistics list.
+const largestFilesCount = 10
+
+// fileSize pairs a file path with its size.
+type fileSize struct {
+	path string
+	size int64
+}
+
+// analysisStats accumulates counters reported in the summary printed once
+// the analysis completes.
+type analysisStats struct {
+	mu        sync.Mutex
+	files     int
+	dirs      int
+	totalSize int64
+	types     map[string]int
+	// sizes counts the files in each bucket of sizeBuckets.
+	sizes            []int
+	largest          []fileSize
+	elidedLines      int
+	elidedFiles      int
+	omittedBinary    int
+	truncatedFiles   int
+	invalidUTF8      int
+	permissionDenied []string
+	symlinkLoops     []string
+	changed          []string
+	generated        []string
+	typeMismatches   []string
+	failures         []traversalError
+}
+
+var stats analysisStats
+
+func (s *analysisStats) recordDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs++
+}
+
+func (s *analysisStats) recordFile(path, fileType string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files++
+	s.totalSize += size
+	if s.types == nil {
+		s.types = map[string]int{}
+	}
+	s.types[fileType]++
+	if s.sizes == nil {
+		s.sizes = make([]int, len(sizeBuckets))
+	}
+	s.sizes[sizeBucket(size)]++
+
+	s.largest = append(s.largest, fileSize{path: path, size: size})
+	sort.SliceStable(s.largest, func(i, j int) bool { return s.largest[i].size > s.largest[j].size })
+	if len(s.largest) > largestFilesCount {
+		s.largest = s.largest[:largestFilesCount]
+	}
+}
+
+func (s *analysisStats) recordElided(lines int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.elidedLines += lines
+	s.elidedFiles++
+}
+
+func (s *analysisStats) recordOmittedBinary() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.omittedBinary++
+}
+
+func (s *analysisStats) recordTruncated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncatedFiles++
+}
+
+func (s *analysisStats) recordInvalidUTF8() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidUTF8++
+}
+
+func (s *analysisStats) recordPermissionDenied(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissionDenied = append(s.permissionDenied, dir)
+}
+
+func (s *analysisStats) recordChanged(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changed = append(s.changed, path)
+}
+
+func (s *analysisStats) recordGenerated(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generated = append(s.generated, path)
+}
+
+// recordTypeMismatch records a file whose extension says text but whose
+// content is binary.
+func (s *analysisStats) recordTypeMismatch(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.typeMismatches = append(s.typeMismatches, path)
+}
+
+// recordError records a path that failed during the traversal for the
+// --error-report.
+func (s *analysisStats) recordError(path string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, traversalError{Path: displayPath(path), Category: errorCategory(err), Error: err.Error()})
+}
+
+// recordSymlinkLoop records the circular symlink at path, reporting
+// whether it wasn't already recorded by an earlier pass.
+func (s *analysisStats) recordSymlinkLoop(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, loop := range s.symlinkLoops {
+		if loop == path {
+			return false
+		}
+	}
+	s.symlinkLoops = append(s.symlinkLoops, path)
+	return true
+}
+
+// printStatistics prints the file and directory counts, total size, type
+// breakdown and largest files.
+func (s *analysisStats) printStatistics() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Printf("Directories: %d\n", s.dirs)
+	fmt.Printf("Files:       %d\n", s.files)
+	fmt.Printf("Total size:  %d bytes\n", s.totalSize)
+
+	if len(s.types) > 0 {
+		fmt.Println("\nFile types:")
+		for _, t := range s.sortedTypes() {
+			fmt.Printf("  %-30s %d\n", t, s.types[t])
+		}
+	}
+
+	if len(s.largest) > 0 {
+		fmt.Println("\nLargest files:")
+		for _, f := range s.largest {
+			fmt.Printf("  %12d  %s\n", f.size, displayPath(f.path))
+		}
+	}
+	printLargestDirs()
+}
+
+// sortedTypes returns the detected file types, most common first. The
+// caller must hold s.mu.
+func (s *analysisStats) sortedTypes() []string {
+	types := make([]string, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if s.types[types[i]] != s.types[types[j]] {
+			return s.types[types[i]] > s.types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// printSummary prints the noteworthy counters gathered during the analysis.
+func (s *analysisStats) printSummary() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.permissionDenied); n > 0 {
+		fmt.Printf("Skipped %d directories due to permission errors.\n", n)
+	}
+	if n := len(s.symlinkLoops); n > 0 {
+		fmt.Printf("Found %d circular symlinks.\n", n)
+	}
+	if n := len(s.changed); n > 0 {
+		fmt.Printf("%d files changed during the scan.\n", n)
+	}
+	if n := len(s.generated); n > 0 {
+		fmt.Printf("Skipped %d generated files.\n", n)
+	}
+	if n := len(s.typeMismatches); n > 0 {
+		fmt.Printf("Treated %d files with a text extension as binary because of their content.\n", n)
+	}
+	if s.omittedBinary > 0 {
+		fmt.Printf("Omitted %d binary files.\n", s.omittedBinary)
+	}
+	if s.elidedLines > 0 {
+		fmt.Printf("Elided %d lines from %d files.\n", s.elidedLines, s.elidedFiles)
+	}
+	if s.invalidUTF8 > 0 {
+		fmt.Printf("Replaced invalid UTF-8 in %d files.\n", s.invalidUTF8)
+	}
+	if s.truncatedFiles > 0 {
+		fmt.Printf("Truncated %d files to --max-content-bytes.\n", s.truncatedFiles)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	traverseSubmodules = true
+	// submodulePaths holds the absolute paths of the git submodules declared
+	// in the .gitmodules files governing the roots.
+	submodulePaths map[string]bool
+)
+
+// loadSubmodules records the submodules declared in the nearest .gitmodules
+// at or above each root.
+func loadSubmodules(roots []string) {
+	submodulePaths = map[string]bool{}
+	for _, root := range roots {
+		for dir := root; ; dir = filepath.Dir(dir) {
+			if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); err == nil {
+				addSubmodules(dir)
+				break
+			}
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+}
+
+// addSubmodules adds the submodule paths listed in dir/.gitmodules.
+func addSubmodules(dir string) {
+	out, err := runGit(dir, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if _, path, ok := strings.Cut(line, " "); ok {
+			submodulePaths[filepath.Join(dir, filepath.FromSlash(path))] = true
+		}
+	}
+}
+
+// isSubmodule reports whether dir is a git submodule.
+func isSubmodule(dir string) bool {
+	return submodulePaths[dir]
+}
+
+// skipSubmodule reports whether the contents of dir are left out because it
+// is a submodule and --submodules=false was given.
+func skipSubmodule(dir string) bool {
+	return !traverseSubmodules && isSubmodule(dir)
+}
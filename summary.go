@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"os"
+)
+
+var summaryOnly bool
+
+// runSummary walks roots applying the analysis filters and prints only the
+// statistics, detecting types from file headers without emitting content.
+func runSummary(roots []string) {
+	for _, root := range roots {
+		summarizeRoot(root)
+	}
+
+	stats.printStatistics()
+	stats.printSummary()
+	printSizeHistogram()
+	if clocEnabled {
+		printCloc()
+	}
+	if nearDupes {
+		printNearDuplicates()
+	}
+}
+
+func summarizeRoot(root string) {
+	walkRoot(root, func(path string, info os.FileInfo, err error) {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) && info != nil && info.IsDir() {
+				stats.recordPermissionDenied(path)
+			} else {
+				slog.Error("Error accessing path", "path", path, "err", err)
+			}
+			return
+		}
+		if info.IsDir() {
+			stats.recordDir(path)
+			return
+		}
+		fileType := detectPathType(path)
+		stats.recordFile(path, fileType, info.Size())
+		if clocEnabled || nearDupes {
+			if content, err := ioutil.ReadFile(path); err == nil {
+				if clocEnabled {
+					recordCloc(path, content)
+				}
+				if nearDupes && isText(fileType) {
+					recordFingerprint(path, content)
+				}
+			}
+		}
+	})
+}
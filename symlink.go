@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// isSymlinkLoop reports whether the symlink at path can never be resolved,
+// or resolves to a directory that contains the link itself, so following it
+// would recurse forever.
+func isSymlinkLoop(path string) bool {
+	info, err := os.Stat(path)
+	if errors.Is(err, syscall.ELOOP) {
+		return true
+	}
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	return parent == target || strings.HasPrefix(parent, target+string(filepath.Separator))
+}
+
+// isLink reports whether info, as returned by Lstat, describes a symlink
+// or, on Windows, another reparse point such as a directory junction, which
+// Go reports as irregular files rather than symlinks.
+func isLink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0 || isReparsePoint(info)
+}
+
+// checkSymlink warns about and records symlinks that loop back on
+// themselves, once per path however many passes of the analysis meet them.
+func checkSymlink(path string, info os.FileInfo) {
+	if !isLink(info) || !isSymlinkLoop(path) || !stats.recordSymlinkLoop(path) {
+		return
+	}
+	slog.Warn("Circular symlink detected", "path", path)
+}
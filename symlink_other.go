@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// isReparsePoint reports whether info is a Windows reparse point, which
+// other platforms don't have.
+func isReparsePoint(info os.FileInfo) bool {
+	return false
+}
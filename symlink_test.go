@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsLink(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink("file.txt", link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	for path, want := range map[string]bool{dir: false, file: false, link: true} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isLink(info); got != want {
+			t.Errorf("isLink(%s) = %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, target string
+		loop         bool
+	}{
+		{"up", "..", true},
+		{"self", "self", true},
+		{"sibling", filepath.Join("..", "other"), false},
+	}
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "sub", tt.name)
+		if err := os.Symlink(tt.target, path); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+		if got := isSymlinkLoop(path); got != tt.loop {
+			t.Errorf("isSymlinkLoop(%s) = %v, want %v", tt.name, got, tt.loop)
+		}
+	}
+}
+
+// TestSymlinkLoopWarning checks that circular symlinks are reported once
+// without the precount, as when the output is piped.
+func TestSymlinkLoopWarning(t *testing.T) {
+	root := writeFixture(t)
+	_, printed := runApp(t, root, "--no-precount")
+	if n := strings.Count(printed, "Circular symlink detected"); n != 1 {
+		t.Errorf("warned %d times about internal/loop, want once:\n%s", n, printed)
+	}
+}
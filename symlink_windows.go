@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// isReparsePoint reports whether info carries the reparse-point attribute,
+// which marks symlinks, junctions and mount points.
+func isReparsePoint(info os.FileInfo) bool {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
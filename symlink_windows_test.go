@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// mklink creates a directory junction at link pointing to target.
+func mklink(t *testing.T, link, target string) {
+	t.Helper()
+	if out, err := exec.Command("cmd", "/c", "mklink", "/J", link, target).CombinedOutput(); err != nil {
+		t.Skipf("creating a junction: %v: %s", err, out)
+	}
+}
+
+func TestJunctionIsLink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "junction")
+	mklink(t, link, target)
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isLink(info) {
+		t.Errorf("junction with mode %v isn't detected as a link", info.Mode())
+	}
+	if info, err := os.Lstat(target); err != nil || isLink(info) {
+		t.Errorf("directory detected as a link (err %v)", err)
+	}
+}
+
+func TestJunctionLoop(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(sub, "up")
+	mklink(t, link, dir)
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(stats.symlinkLoops)
+	checkSymlink(link, info)
+	if len(stats.symlinkLoops) != before+1 {
+		t.Error("junction pointing at its own ancestor wasn't recorded as circular")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+// formatTar packages the included files as a tar archive.
+const formatTar = "tar"
+
+var (
+	gzipOutput bool
+	// tarRoots are the roots entry names in the archive are relative to.
+	tarRoots []string
+
+	tarWriter *tar.Writer
+	tarGzip   *gzip.Writer
+)
+
+func init() {
+	apptree.RegisterStream(formatTar, func(apptree.Framing) apptree.StreamRenderer { return tarRenderer{} })
+}
+
+// tarRenderer packages the directories and files of the output, with the
+// files' content as read.
+type tarRenderer struct{}
+
+func (tarRenderer) Begin(w io.Writer) error {
+	openTar(w)
+	return nil
+}
+
+func (tarRenderer) End(w io.Writer) error { return closeTar() }
+
+func (tarRenderer) Dir(w io.Writer, dir apptree.Entry) error {
+	if dir.Err != nil {
+		return nil
+	}
+	return writeTarDir(dir.Path)
+}
+
+func (tarRenderer) File(w io.Writer, f apptree.File) error {
+	if f.HeaderOnly {
+		return nil
+	}
+	return writeTarFile(f.Path, f.Raw)
+}
+
+func (tarRenderer) Note(w io.Writer, n apptree.Note) error { return nil }
+
+// openTar starts the archive written to w, compressed with --gzip.
+func openTar(w io.Writer) {
+	tarGzip = nil
+	if gzipOutput {
+		tarGzip = gzip.NewWriter(w)
+		w = tarGzip
+	}
+	tarWriter = tar.NewWriter(w)
+}
+
+// closeTar writes the end of the archive.
+func closeTar() error {
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if tarGzip != nil {
+		return tarGzip.Close()
+	}
+	return nil
+}
+
+// tarName returns the name of path inside the archive: relative to its
+// root, under the root's own name when several roots are packaged.
+func tarName(path string) string {
+	for _, root := range tarRoots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(tarRoots) > 1 {
+			rel = filepath.Join(filepath.Base(root), rel)
+		}
+		return filepath.ToSlash(rel)
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// writeTarDir adds the directory dir to the archive.
+func writeTarDir(dir string) error {
+	name := tarName(dir)
+	if name == "." {
+		return nil
+	}
+	return writeTarEntry(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: tarModTime(dir)}, nil)
+}
+
+// writeTarFile adds file with the given content to the archive.
+func writeTarFile(file string, content []byte) error {
+	mode := int64(0644)
+	if info, err := os.Stat(file); err == nil {
+		mode = int64(info.Mode().Perm())
+	}
+	return writeTarEntry(&tar.Header{Typeflag: tar.TypeReg, Name: tarName(file), Mode: mode, Size: int64(len(content)), ModTime: tarModTime(file)}, content)
+}
+
+// tarModTime returns the modification time recorded for path, which
+// --deterministic leaves at the zero time.
+func tarModTime(path string) time.Time {
+	if deterministic {
+		return time.Unix(0, 0)
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Unix(0, 0)
+}
+
+func writeTarEntry(hdr *tar.Header, content []byte) error {
+	if err := tarWriter.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tarWriter.Write(content)
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTarToStdout checks that --output-dir - writes the archive to stdout
+// and the messages to stderr.
+func TestTarToStdout(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], root, "--format", "tar", "--output-dir", "-")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("app-tree: %v\n%s", err, stderr.String())
+	}
+
+	r := tar.NewReader(&stdout)
+	var names []string
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the archive from stdout: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if got, want := strings.Join(names, " "), "src/ src/main.go"; got != want {
+		t.Errorf("archive entries are %q, want %q", got, want)
+	}
+	if !strings.Contains(stderr.String(), "Analysis complete! Output written to stdout.") {
+		t.Errorf("stderr is missing the completion message:\n%s", stderr.String())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("output files were written to the working directory: %v", entries)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarFS is a read-only file system holding the regular files of a tar
+// archive and the directories containing them, so an archive can be walked
+// like a directory. Entries over --max-archive-entry-size keep their size
+// but not their content, and fail to read.
+type tarFS map[string]*tarEntry
+
+// tarEntry is a file or directory of a tarFS.
+type tarEntry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+	content []byte
+	// children are the base names of a directory's entries.
+	children []string
+}
+
+// readTarFS reads the tar archive from r into a tarFS.
+func readTarFS(r io.Reader) (tarFS, error) {
+	fsys := tarFS{".": {name: ".", dir: true}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fsys.addDir(name).modTime = hdr.ModTime
+		case tar.TypeReg:
+			e := &tarEntry{name: name, size: hdr.Size, modTime: hdr.ModTime}
+			content, err := readArchiveEntry(tr, hdr.Size)
+			switch {
+			case errors.Is(err, errArchiveEntryTooLarge):
+				// The reader skips the rest of the member on the next
+				// call.
+			case err != nil:
+				return nil, err
+			default:
+				e.content = content
+			}
+			fsys.add(e)
+		}
+	}
+}
+
+// addDir returns the directory at name, adding it and its parents if
+// needed.
+func (fsys tarFS) addDir(name string) *tarEntry {
+	if e, ok := fsys[name]; ok && e.dir {
+		return e
+	}
+	e := &tarEntry{name: name, dir: true}
+	fsys.add(e)
+	return e
+}
+
+// add adds e to its parent directory, replacing an entry of the same name.
+func (fsys tarFS) add(e *tarEntry) {
+	if _, ok := fsys[e.name]; !ok {
+		parent := fsys.addDir(path.Dir(e.name))
+		parent.children = append(parent.children, path.Base(e.name))
+	}
+	fsys[e.name] = e
+}
+
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	e, ok := fsys[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tarFile{tarEntry: e, fsys: fsys}, nil
+}
+
+func (fsys tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, ok := fsys[name]
+	if !ok || !e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, child := range e.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fsys[path.Join(name, child)]))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// tarEntry is its own fs.FileInfo.
+
+func (e *tarEntry) Name() string       { return path.Base(e.name) }
+func (e *tarEntry) Size() int64        { return e.size }
+func (e *tarEntry) ModTime() time.Time { return e.modTime }
+func (e *tarEntry) IsDir() bool        { return e.dir }
+func (e *tarEntry) Sys() interface{}   { return nil }
+
+func (e *tarEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// tarFile is an open tarEntry.
+type tarFile struct {
+	*tarEntry
+	fsys   tarFS
+	offset int
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.tarEntry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.content == nil && f.size > 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errArchiveEntryTooLarge}
+	}
+	if f.offset >= len(f.content) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.content[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.fsys.ReadDir(f.name)
+	if err != nil || n <= 0 {
+		return entries, err
+	}
+	if f.offset >= len(entries) {
+		return nil, io.EOF
+	}
+	entries = entries[f.offset:]
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	f.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	timeout time.Duration
+	// analysisCtx is done once --timeout expires. The traversal checks it
+	// between entries and stops, leaving partial output.
+	analysisCtx = context.Background()
+)
+
+// startTimeout applies --timeout to analysisCtx. The returned function
+// releases its timer.
+func startTimeout() (cancel func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	analysisCtx, cancel = context.WithTimeout(context.Background(), timeout)
+	return cancel
+}
+
+// analysisStopped reports whether the analysis was cut short by --timeout.
+func analysisStopped() bool {
+	return analysisCtx.Err() != nil
+}
+
+// writePartialNote ends output that --timeout cut short with a note saying
+// so.
+func writePartialNote() {
+	if !analysisStopped() {
+		return
+	}
+	writeNote(apptree.Note{
+		Kind:    apptree.NoteText,
+		Text:    fmt.Sprintf("\n[Partial output: the analysis timed out after %s]\n", timeout),
+		Records: []jsonlRecord{{Kind: "partial", Message: fmt.Sprintf("analysis timed out after %s", timeout)}},
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var topFiles int
+
+// renderTopFiles outputs the --top files under roots ranked by --sort across
+// the whole tree, without directory headers.
+func renderTopFiles(roots []string) {
+	var files []apptree.Entry
+	for _, root := range roots {
+		collectFiles(root, &files)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if sortKey == sortByName {
+			return files[i].Path < files[j].Path
+		}
+		return sortsBefore(files[i].Info, files[j].Info)
+	})
+	if len(files) > topFiles {
+		files = files[:topFiles]
+	}
+
+	for _, f := range files {
+		if analysisStopped() {
+			break
+		}
+		processFile(f)
+	}
+}
+
+// collectFiles appends the files under dir that the traversal would visit.
+func collectFiles(dir string, files *[]apptree.Entry) {
+	tree, _ := apptree.AnalyzeContext(analysisCtx, rootOptions(dir))
+	if tree == nil {
+		return
+	}
+	for _, n := range tree.Files() {
+		*files = append(*files, n.Entry())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+const (
+	formatJSON     = apptree.FormatJSON
+	formatMarkdown = apptree.FormatMarkdown
+)
+
+// flattenDepth dissolves the directories above this depth in tree formats.
+var flattenDepth int
+
+// treeFormats maps the formats rendered from the apptree tree, by the
+// renderer registered under the same name, to the file they write. Other
+// formats stream file content during the traversal; adding a tree format
+// only takes registering its renderer and naming its file here.
+var treeFormats = map[string]string{
+	formatJSON:     "app_tree.json",
+	formatMarkdown: "app_tree.md",
+}
+
+// isTreeFormat reports whether --format names a tree format.
+func isTreeFormat() bool {
+	_, ok := treeFormats[outputFormat]
+	return ok
+}
+
+// renderTrees writes the trees of roots in the --format tree format as a
+// single document. Several roots are gathered under a directory standing
+// for their common parent, so the document has one root either way. With
+// --jobs, renderers that can split the work render subtrees concurrently.
+func renderTrees(roots []string) {
+	r, ok := apptree.Lookup(outputFormat)
+	if !ok {
+		slog.Error("No renderer registered", "format", outputFormat)
+		return
+	}
+	var trees []*apptree.Node
+	for _, root := range roots {
+		tree, err := apptree.AnalyzeContext(analysisCtx, rootOptions(root))
+		if tree == nil {
+			slog.Error("Error analyzing directory", "path", root, "err", err)
+			stats.recordError(root, err)
+			continue
+		}
+		tree.Walk(func(n *apptree.Node) {
+			if n.Err != nil {
+				stats.recordError(n.Path, n.Err)
+			}
+			n.Path = displayPath(n.Path)
+			if deterministic {
+				n.ModTime = time.Time{}
+			}
+		})
+		trees = append(trees, tree)
+	}
+	if len(trees) == 0 {
+		return
+	}
+
+	tree := trees[0]
+	if len(trees) > 1 {
+		tree = joinTrees(commonParent(roots), trees)
+	}
+	summary := apptree.Summarize(tree)
+	if len(trees) > 1 {
+		for i, child := range tree.Children {
+			tree.Children[i] = apptree.Flatten(child, flattenDepth)
+		}
+	} else {
+		tree = apptree.Flatten(tree, flattenDepth)
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if outputErr == nil {
+		// Rendering is CPU bound, so more goroutines than processors only
+		// add the cost of splitting the tree.
+		cr, ok := r.(apptree.ConcurrentRenderer)
+		var err error
+		if n := min(jobs, runtime.GOMAXPROCS(0)); ok && n > 1 {
+			err = cr.RenderConcurrent(rawOutput, tree, summary, n)
+		} else {
+			err = r.Render(rawOutput, tree, summary)
+		}
+		if err != nil {
+			outputErr = fmt.Errorf("rendering %s: %w", outputFormat, err)
+		}
+	}
+}
+
+// joinTrees returns a directory node for parent holding trees, which count
+// as its directories.
+func joinTrees(parent string, trees []*apptree.Node) *apptree.Node {
+	root := &apptree.Node{Name: filepath.Base(parent), Path: displayPath(parent), Dir: true, Children: trees}
+	for _, tree := range trees {
+		root.Size += tree.Size
+		root.Partial = root.Partial || tree.Partial
+	}
+	return root
+}
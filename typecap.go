@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	maxFilesPerType int
+
+	typeCapMu     sync.Mutex
+	typeCapCounts = map[string]int{}
+)
+
+// overTypeCap counts a file of fileType and reports whether it is beyond
+// --max-total-files-per-type, so only its type is summarized at the end.
+func overTypeCap(fileType string) bool {
+	typeCapMu.Lock()
+	defer typeCapMu.Unlock()
+	typeCapCounts[fileType]++
+	return typeCapCounts[fileType] > maxFilesPerType
+}
+
+// writeTypeCapSummary notes how many files of each type were left out by
+// --max-total-files-per-type at the end of the output.
+func writeTypeCapSummary() {
+	typeCapMu.Lock()
+	var types []string
+	for fileType, n := range typeCapCounts {
+		if n > maxFilesPerType {
+			types = append(types, fileType)
+		}
+	}
+	sort.Strings(types)
+	counts := map[string]int{}
+	for _, fileType := range types {
+		counts[fileType] = typeCapCounts[fileType] - maxFilesPerType
+	}
+	typeCapMu.Unlock()
+
+	for _, fileType := range types {
+		writeNote(apptree.Note{
+			Kind:    apptree.NoteText,
+			Text:    fmt.Sprintf("\n[%d more %s files omitted, over %d of that type]\n", counts[fileType], fileType, maxFilesPerType),
+			Records: []jsonlRecord{{Kind: "omitted", Type: fileType, Omitted: counts[fileType]}},
+		})
+	}
+}
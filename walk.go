@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var (
+	excludePatterns []string
+	maxDepth        int
+	// analysisOptions holds the apptree options the flags map onto. Its
+	// Root is set per walk.
+	analysisOptions apptree.Options
+	// analysisRoots are used to measure the depth of entries for
+	// --max-depth.
+	analysisRoots []string
+)
+
+// configureAnalysis maps --exclude, --max-depth, --sort, --dirs-first,
+// --files-first, --limit-per-dir, --pin, --jobs, --format and the name,
+// type and empty-file filters onto the apptree options used to walk
+// roots, along with the hooks reading, preparing and describing files for
+// the content writer.
+func configureAnalysis(roots []string) error {
+	if err := validateSortKey(); err != nil {
+		return err
+	}
+	if err := validatePins(); err != nil {
+		return err
+	}
+	for _, pattern := range excludePatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude pattern %q: %w", pattern, err)
+		}
+	}
+	if maxDepth < 0 {
+		return fmt.Errorf("--max-depth must not be negative, got %d", maxDepth)
+	}
+	if flattenDepth < 0 {
+		return fmt.Errorf("--flatten-depth must not be negative, got %d", flattenDepth)
+	}
+
+	opts := []apptree.Option{
+		apptree.WithExcludes(excludePatterns...),
+		apptree.WithMaxDepth(maxDepth),
+		apptree.WithSort(sortKey),
+		apptree.WithLimitPerDir(limitPerDir),
+		apptree.WithPins(pinPatterns...),
+		apptree.WithConcurrency(jobs),
+		apptree.WithFormat(outputFormat),
+	}
+	switch {
+	case filesFirst:
+		opts = append(opts, apptree.WithFilesFirst())
+	case dirsFirst:
+		opts = append(opts, apptree.WithDirsFirst())
+	}
+	analysisOptions = apptree.NewOptions("", opts...)
+	analysisOptions.SkipEmpty = !includeEmptyFiles
+	analysisOptions.IncludeTypes = includeTypes
+	analysisOptions.ExcludeTypes = excludeTypes
+	analysisOptions.TypeOf = detectPathType
+	analysisOptions.Load = loadEntry
+	analysisOptions.ContentType = resolveType
+	analysisOptions.Prepare = prepareFile
+	analysisOptions.Describe = describeEntry
+	analysisOptions.OnError = reportReadError
+	if err := compileNameFilters(&analysisOptions); err != nil {
+		return err
+	}
+	analysisRoots = roots
+	return nil
+}
+
+// beyondMaxDepth reports whether path lies more than --max-depth levels
+// below the root containing it.
+func beyondMaxDepth(path string) bool {
+	if analysisOptions.MaxDepth == 0 {
+		return false
+	}
+	for _, root := range analysisRoots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return strings.Count(rel, string(filepath.Separator))+1 > analysisOptions.MaxDepth
+	}
+	return false
+}
+
+// rootOptions returns the options for analyzing root. The analysis
+// applies its own selections and --explain on top of the flag filters,
+// reports the circular symlinks it includes, and leaves out the contents of
+// skipped submodules.
+func rootOptions(root string) apptree.Options {
+	opts := analysisOptions
+	opts.Root = root
+	opts.Skip = isOutputFile
+	opts.Select = selectEntry
+	opts.Filter = func(path string, info os.FileInfo) bool {
+		if !filterEntry(path, info) {
+			return false
+		}
+		checkSymlink(path, info)
+		return true
+	}
+	if explainVisits {
+		opts.Explain = explainDecision
+	}
+	opts.Descend = func(path string) bool { return !skipSubmodule(path) }
+	return opts
+}
+
+// walkRoot calls visit for root and every entry below it that the analysis
+// includes, in lexical order, with directories before their entries.
+// Submodules are visited without their content unless they are traversed.
+// As with filepath.Walk, a directory that can't be listed is visited again
+// with the error, and entries that can't be read have a nil info.
+func walkRoot(root string, visit func(path string, info os.FileInfo, err error)) {
+	tree, err := apptree.AnalyzeContext(analysisCtx, rootOptions(root))
+	if tree == nil {
+		visit(root, nil, err)
+		return
+	}
+	if tree.Partial {
+		slog.Warn("Analysis timed out, results are partial", "path", root, "timeout", timeout)
+	}
+	tree.Walk(func(n *apptree.Node) {
+		if n.Info == nil {
+			visit(n.Path, nil, n.Err)
+			return
+		}
+		visit(n.Path, n.Info, nil)
+		if n.Err != nil {
+			visit(n.Path, n.Info, n.Err)
+		}
+	})
+}
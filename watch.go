@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var watchMode bool
+
+// watchDebounce is how long the tree must stay quiet after a change before
+// it is analyzed again, so a burst of saves causes a single rebuild.
+const watchDebounce = 500 * time.Millisecond
+
+// liveReloadScript is injected into served pages while watching. It reloads
+// the page whenever a rebuild completes; EventSource reconnects by itself
+// when the connection drops.
+const liveReloadScript = `<script>
+    new EventSource('/events').addEventListener('reload', function () { location.reload(); });
+</script>
+`
+
+// liveReload tells the pages connected to /events to reload. It is nil
+// unless --watch is given.
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+var reloads *liveReload
+
+// notify asks every connected page to reload.
+func (l *liveReload) notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A reload is already pending for this client.
+		}
+	}
+}
+
+// ServeHTTP streams Server-Sent Events to a page until it disconnects.
+func (l *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	l.mu.Lock()
+	l.clients[ch] = true
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, ch)
+		l.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// injectLiveReload adds the live reload client to an HTML page.
+func injectLiveReload(page []byte) []byte {
+	s := string(page)
+	if i := strings.LastIndex(s, "</body>"); i >= 0 {
+		return []byte(s[:i] + liveReloadScript + s[i:])
+	}
+	return []byte(s + liveReloadScript)
+}
+
+// watchAndRebuild regenerates the output at path whenever something under
+// roots changes, then asks the served pages to reload. Each rebuild runs
+// this program again with the same arguments, so no state is carried over
+// from the previous analysis.
+func watchAndRebuild(roots []string, path string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Error starting file watcher", "err", err)
+		return
+	}
+	defer watcher.Close()
+	for _, root := range roots {
+		watchTree(watcher, root)
+	}
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchTree(watcher, event.Name)
+				}
+			}
+			slog.Debug("Change detected", "path", event.Name, "op", event.Op.String())
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("File watcher error", "err", err)
+		case <-timer.C:
+			if err := rebuildOutput(path); err != nil {
+				slog.Error("Error rebuilding output", "err", err)
+				continue
+			}
+			fmt.Println("Tree changed, output rebuilt.")
+			reloads.notify()
+		}
+	}
+}
+
+// watchTree watches dir and the directories below it that the analysis
+// visits. Git's own directory is left out as it changes on every command.
+func watchTree(watcher *fsnotify.Watcher, dir string) {
+	opts := rootOptions(dir)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && (info.Name() == ".git" || !opts.Include(path, info)) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			slog.Warn("Error watching directory", "path", path, "err", err)
+		}
+		return nil
+	})
+}
+
+// rebuildOutput runs the analysis again into a scratch directory next to
+// path and moves the result over it.
+func rebuildOutput(path string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), "rebuild")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Later flags override earlier ones, so the original arguments can be
+	// kept as they are. Options ignored while serving stay off.
+	args := append(append([]string{}, os.Args[1:]...),
+		"--watch=false", "--serve=false", "--clipboard=false", "--split-by-dir=false", "--resume=false", "--append=false",
+		"--output-dir", dir)
+	cmd := exec.Command(exe, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return os.Rename(filepath.Join(dir, filepath.Base(path)), path)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/Cdaprod/app-tree/apptree"
+)
+
+var showXattrs bool
+
+// xattr is an extended attribute of a file, listed by --xattrs.
+type xattr = apptree.Xattr
+
+// fileXattrs returns the extended attributes of file for --xattrs. Files
+// without any, archive entries and platforms without extended attributes
+// give none.
+func fileXattrs(file string) []xattr {
+	if !showXattrs {
+		return nil
+	}
+	attrs, err := listXattrs(file)
+	if err != nil {
+		slog.Debug("Not listing extended attributes", "path", file, "err", err)
+		return nil
+	}
+	return attrs
+}
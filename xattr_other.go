@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func listXattrs(file string) ([]xattr, error) {
+	return nil, errors.New("extended attributes are not supported on this platform")
+}
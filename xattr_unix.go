@@ -0,0 +1,39 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// listXattrs returns the names and value sizes of the extended attributes
+// of file, sorted by name. On macOS these include resource forks, stored as
+// com.apple.ResourceFork.
+func listXattrs(file string) ([]xattr, error) {
+	size, err := unix.Listxattr(file, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(file, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []xattr
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := unix.Getxattr(file, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, xattr{Name: string(name), Size: n})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+	return attrs, nil
+}